@@ -0,0 +1,64 @@
+package orexis
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	acceptBackoffMin = 5 * time.Millisecond
+	acceptBackoffMax = 1 * time.Second
+	// バックオフ中の警告はこの間隔に1回だけ出す
+	acceptWarnInterval = 10 * time.Second
+)
+
+// isTransientAcceptError reports whether Accept failed for a reason that
+// goes away on its own, most commonly running out of file descriptors.
+func isTransientAcceptError(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM,
+		syscall.ECONNABORTED, syscall.ECONNRESET, syscall.EINTR,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptBackoff sleeps between retries after transient Accept errors so a
+// full fd table does not turn the accept loop into a busy spin.
+type acceptBackoff struct {
+	delay      time.Duration
+	lastWarn   time.Time
+	suppressed int
+}
+
+func (b *acceptBackoff) wait(err error) {
+	if b.delay == 0 {
+		b.delay = acceptBackoffMin
+	} else {
+		b.delay = min(b.delay*2, acceptBackoffMax)
+	}
+
+	if now := time.Now(); now.Sub(b.lastWarn) >= acceptWarnInterval {
+		logInfo("Warning: accept failing (%v), backing off %v; %d similar errors suppressed", err, b.delay, b.suppressed)
+		b.lastWarn = now
+		b.suppressed = 0
+	} else {
+		b.suppressed++
+	}
+
+	time.Sleep(b.delay)
+}
+
+// reset is called after a successful Accept.
+func (b *acceptBackoff) reset() {
+	b.delay = 0
+}
@@ -0,0 +1,92 @@
+package orexis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// IPList is a set of IPv4/IPv6 CIDR ranges.
+type IPList []*net.IPNet
+
+// ParseIPList builds a list from a comma-separated spec and, if path is
+// non-empty, a file with one entry per line. Blank lines and lines starting
+// with '#' are ignored. A bare address is treated as a single-host range.
+func ParseIPList(spec, path string) (IPList, error) {
+	var list IPList
+
+	for _, entry := range strings.Split(spec, ",") {
+		if err := list.add(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := scanner.Text()
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			if err := list.add(line); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+func (l *IPList) add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", entry)
+		}
+		if ip.To4() != nil {
+			entry += "/32"
+		} else {
+			entry += "/128"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(entry)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q", entry)
+	}
+	*l = append(*l, ipNet)
+	return nil
+}
+
+// contains reports whether host, an IP address string, falls in any range.
+func (l IPList) contains(host string) bool {
+	if len(l) == 0 {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package orexis
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+// splitAddr returns addr's host in canonical form and its port. IPv4-mapped
+// IPv6 addresses are unmapped and IPv6 zones are dropped, so the same peer
+// is always logged, limited and matched against Allow/Deny under one key.
+// Addresses that are not IP based (Unix sockets) yield an empty host.
+func splitAddr(addr net.Addr) (host, port string) {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		host, port, _ = net.SplitHostPort(addr.String())
+		return host, port
+	}
+	return canonicalIP(ap.Addr()).String(), strconv.Itoa(int(ap.Port()))
+}
+
+func canonicalIP(ip netip.Addr) netip.Addr {
+	// リンクローカルの %eth0 などはインターフェースを表すだけで、相手の識別には使わない
+	return ip.Unmap().WithZone("")
+}
@@ -0,0 +1,27 @@
+package orexis
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSplitAddr(t *testing.T) {
+	tests := []struct {
+		addr       net.Addr
+		host, port string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}, "192.0.2.1", "22"},
+		// IPv4-mapped IPv6 は IPv4 と同じ送信元として扱う
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:192.0.2.1"), Port: 22}, "192.0.2.1", "22"},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 2222}, "2001:db8::1", "2222"},
+		// ゾーンは落とす
+		{&net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 22, Zone: "eth0"}, "fe80::1", "22"},
+		{&net.UnixAddr{Name: "/run/orexis.sock", Net: "unix"}, "", ""},
+	}
+	for _, tt := range tests {
+		host, port := splitAddr(tt.addr)
+		if host != tt.host || port != tt.port {
+			t.Errorf("splitAddr(%v) = %q, %q, want %q, %q", tt.addr, host, port, tt.host, tt.port)
+		}
+	}
+}
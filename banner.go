@@ -0,0 +1,83 @@
+package orexis
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// LoadBannerFile reads the decoy lines served instead of random ones. An
+// empty result means the caller should fall back to the random generator.
+func LoadBannerFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, nil
+}
+
+// SetBanner replaces Config.Banner in the running configuration, leaving
+// every other field as it is, so that the served lines can be changed more
+// often than a full Reload would be convenient, e.g. from a pipe. Passing
+// no lines switches back to random lines. Trapped clients carry on from
+// their current position in the new list.
+func (s *Server) SetBanner(lines []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := *s.config.Load()
+	config.Banner = lines
+	_, err := s.swapConfig(&config)
+	return err
+}
+
+// formatBannerLineInto copies line into buf, truncated so that it fits in
+// maxLen with the terminator term, applies the same "SSH-" rewrite as
+// generateLine and returns the length written.
+func formatBannerLineInto(buf []byte, line string, maxLen int, term string) int {
+	if line == "" && term == "" {
+		// 0 バイトの行は書き込みようがないので空白1つにする
+		line = " "
+	}
+	if len(line) > maxLen-len(term) {
+		line = line[:maxLen-len(term)]
+	}
+	n := copy(buf, line)
+	avoidSSHPrefix(buf[:n], term)
+	return n + copy(buf[n:], term)
+}
+
+// validateSSHBanner checks an -ssh-banner value against RFC 4253 section
+// 4.2: it must start with "SSH-" and fit in 255 bytes including CRLF.
+func validateSSHBanner(banner string) error {
+	if !strings.HasPrefix(banner, "SSH-") {
+		return errors.New(`must start with "SSH-"`)
+	}
+	if strings.ContainsAny(banner, "\r\n") {
+		return errors.New("must not contain CR or LF")
+	}
+	if len(banner)+2 > 255 {
+		return errors.New("must be at most 253 bytes")
+	}
+	return nil
+}
+
+// initialLine returns the line to send before any generated ones, or "" if
+// there is none. Unlike generated lines it deliberately keeps the "SSH-"
+// prefix, so that RFC 4253-aware scanners see a real server version.
+func initialLine(config *Config) string {
+	if config.SSHBanner == "" {
+		return ""
+	}
+	return config.SSHBanner + "\r\n"
+}
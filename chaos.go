@@ -0,0 +1,51 @@
+package orexis
+
+import (
+	"math/rand/v2"
+	"unicode/utf8"
+)
+
+// Config.Chaos の行のうち、この割合 (1/N) にエスケープシーケンスを混ぜる
+const chaosOneIn = 16
+
+// chaosSequences are the ANSI sequences Config.Chaos mixes in: cursor
+// moves, screen and line clears and colour changes. None contains CR or LF,
+// so the line terminator stays where it is.
+var chaosSequences = []string{
+	"\x1b[H",    // カーソルを左上へ
+	"\x1b[2J",   // 画面を消去
+	"\x1b[K",    // 行末まで消去
+	"\x1b[3A",   // カーソルを3行上へ
+	"\x1b[20C",  // カーソルを20桁右へ
+	"\x1b[0m",   // 色をリセット
+	"\x1b[31m",  // 赤
+	"\x1b[8m",   // 非表示
+	"\x1b[?25l", // カーソルを隠す
+}
+
+// injectChaos overwrites part of a generated line body with a random ANSI
+// sequence, for one line in chaosOneIn. Sequences start with ESC, so the
+// body can no longer begin with "SSH-"; with utf8 the overwrite starts on a
+// rune boundary and the cut rune behind it is padded with '~'.
+func injectChaos(rng *rand.Rand, body []byte, charset string) {
+	if rng.IntN(chaosOneIn) != 0 {
+		return
+	}
+	seq := chaosSequences[rng.IntN(len(chaosSequences))]
+	if len(seq) > len(body) {
+		return
+	}
+
+	p := rng.IntN(len(body) - len(seq) + 1)
+	if charset == CharsetUTF8 {
+		for p > 0 && !utf8.RuneStart(body[p]) {
+			p--
+		}
+	}
+	end := p + copy(body[p:], seq)
+	if charset == CharsetUTF8 {
+		for ; end < len(body) && !utf8.RuneStart(body[end]); end++ {
+			body[end] = '~'
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package orexis
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	CharsetASCII  = "ascii"
+	CharsetLatin1 = "printable-latin1"
+	CharsetUTF8   = "utf8"
+)
+
+func validateCharset(charset string) error {
+	switch charset {
+	case CharsetASCII, CharsetLatin1, CharsetUTF8:
+		return nil
+	}
+	return fmt.Errorf("unknown charset %q (want %s, %s or %s)", charset, CharsetASCII, CharsetLatin1, CharsetUTF8)
+}
+
+// alphabet is the set of single-byte characters random lines are drawn
+// from: printable ASCII, plus 160-255 for printable-latin1, minus
+// Config.ExcludeBytes. utf8 lines use it for their ASCII characters, and
+// the wordlike style only its letters and space.
+type alphabet struct {
+	charset string
+	style   string
+	bytes   []byte
+	// StyleWordlike で交互に使う母音と子音
+	vowels, consonants []byte
+	// "SSH-" で始まる行の先頭を書き換える文字。'X' が除外されていれば別の文字にする
+	lead byte
+}
+
+// 設定ごとに作り直さないよう、charset、Style と ExcludeBytes の組み合わせごとに使い回す
+var alphabets sync.Map
+
+// alphabetFor returns the alphabet for charset and style without the bytes
+// in exclude, which must have passed validateExcludeBytes.
+func alphabetFor(charset, style, exclude string) *alphabet {
+	key := charset + "\x00" + style + "\x00" + exclude
+	if a, ok := alphabets.Load(key); ok {
+		return a.(*alphabet)
+	}
+
+	a := &alphabet{charset: charset, style: style, lead: 'X'}
+	for b := 32; b <= 255; b++ {
+		// 127-159 は制御文字なので飛ばす。Latin-1 以外では ASCII だけ
+		if b > 126 && (charset != CharsetLatin1 || b < 160) {
+			continue
+		}
+		if strings.IndexByte(exclude, byte(b)) < 0 {
+			a.bytes = append(a.bytes, byte(b))
+		}
+	}
+	for _, b := range a.bytes {
+		switch {
+		case strings.IndexByte("aeiou", b) >= 0:
+			a.vowels = append(a.vowels, b)
+		case b >= 'a' && b <= 'z':
+			a.consonants = append(a.consonants, b)
+		}
+	}
+	if strings.IndexByte(exclude, 'X') >= 0 {
+		for _, b := range a.bytes {
+			if b != 'S' {
+				a.lead = b
+				break
+			}
+		}
+	}
+	v, _ := alphabets.LoadOrStore(key, a)
+	return v.(*alphabet)
+}
+
+// validateExcludeBytes checks that excluding exclude from charset still
+// leaves at least two characters, so lines can vary and "SSH-" can always
+// be rewritten.
+func validateExcludeBytes(charset, exclude string) error {
+	if charset == CharsetUTF8 {
+		for i := 0; i < len(exclude); i++ {
+			if exclude[i] >= utf8.RuneSelf {
+				return fmt.Errorf("exclude bytes: only ASCII can be excluded with the %s charset", CharsetUTF8)
+			}
+		}
+	}
+	if n := len(alphabetFor(charset, StyleRandom, exclude).bytes); n < 2 {
+		return fmt.Errorf("exclude bytes leave %d characters, need at least 2", n)
+	}
+	return nil
+}
+
+// fill fills buf with random bytes of a.
+func (a *alphabet) fill(rng *rand.Rand, buf []byte) {
+	for i := range buf {
+		buf[i] = a.bytes[rng.IntN(len(a.bytes))]
+	}
+}
+
+// utf8Ranges are the code point ranges fillUTF8 draws from, covering one to
+// three byte encodings.
+var utf8Ranges = [][2]rune{
+	{0x0020, 0x007e}, // ASCII
+	{0x00a1, 0x00ff}, // Latin-1 Supplement
+	{0x0391, 0x03c9}, // Greek
+	{0x0410, 0x044f}, // Cyrillic
+	{0x3041, 0x3096}, // Hiragana
+	{0x4e00, 0x9fff}, // CJK Unified Ideographs
+}
+
+// fillUTF8 fills buf exactly with valid UTF-8. When the next rune would not
+// fit in the remaining space, an ASCII character is used instead. ASCII
+// characters come from a, so excluded bytes never appear.
+func (a *alphabet) fillUTF8(rng *rand.Rand, buf []byte) {
+	for i := 0; i < len(buf); {
+		r := utf8Ranges[rng.IntN(len(utf8Ranges))]
+		var c rune
+		if r == utf8Ranges[0] {
+			c = rune(a.bytes[rng.IntN(len(a.bytes))])
+		} else {
+			c = r[0] + rune(rng.IntN(int(r[1]-r[0]+1)))
+		}
+		if utf8.RuneLen(c) > len(buf)-i {
+			c = rune(a.bytes[rng.IntN(len(a.bytes))])
+		}
+		i += utf8.EncodeRune(buf[i:], c)
+	}
+}
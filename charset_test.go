@@ -0,0 +1,33 @@
+package orexis
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCharsetLines(t *testing.T) {
+	rng := NewSeededRand(1)
+	for _, charset := range []string{CharsetASCII, CharsetLatin1, CharsetUTF8} {
+		a := alphabetFor(charset, StyleRandom, "")
+		for i := 0; i < 1000; i++ {
+			line := generateLine(rng, 3, MaxLineLengthLimit, a, "\r\n")
+			body, ok := strings.CutSuffix(line, "\r\n")
+			if !ok || strings.ContainsAny(body, "\r\n") {
+				t.Fatalf("%s: line %q is not terminated once by CRLF", charset, line)
+			}
+			if charset == CharsetUTF8 {
+				if !utf8.ValidString(body) {
+					t.Fatalf("%s: line %q is not valid UTF-8", charset, line)
+				}
+				continue
+			}
+			for j := 0; j < len(body); j++ {
+				b := body[j]
+				if b < 0x20 || b == 0x7f || b >= 0x80 && (charset != CharsetLatin1 || b < 0xa0) {
+					t.Fatalf("%s: line %q has byte %#x", charset, line, b)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package orexis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// clientState is the bookkeeping shared by every trapped client, whether
+// it is driven by its own goroutine or by the poller.
+type clientState struct {
+	// この接続が従う設定。受け付けたリスナーによっては ServeWith の Overrides が入っている
+	conf *atomic.Pointer[Config]
+	// 受け付けた順に振る通し番号。ACCEPT、DISCONNECT、CONNECTION に id として出し、ログを突き合わせる鍵にする
+	id     int64
+	host   string
+	port   string
+	remote string
+	// クライアントを受け付けたこちら側のポート
+	localPort string
+	start     time.Time
+	// この接続に送ったバイト数と書き込み回数。接続を扱うゴルーチンだけが更新する
+	bytes  int64
+	writes int64
+	// -close-read で受信側を閉じたか。閉じると相手の切断を EPOLLRDHUP で検知できない
+	readClosed bool
+	// ACCEPT と DISCONNECT の代わりに切断時の CONNECTION 1行だけを出す。途中で Reload されても
+	// 1つの接続の出力が混ざらないよう、受け付けた時点の設定で決める
+	record bool
+	// LogSample で間引かれた接続は ACCEPT も DISCONNECT も出さない
+	logged  bool
+	country string
+	// Kick で閉じられた。切断理由を kicked にする
+	kicked atomic.Bool
+	// Shutdown か Kick で ResetOnClose により RST で閉じる
+	reset atomic.Bool
+	// MILESTONE を出した最後の閾値
+	milestone time.Duration
+}
+
+// addSent records n bytes written to cs.
+func (s *Server) addSent(cs *clientState, n int) {
+	cs.bytes += int64(n)
+	cs.writes++
+	s.bytesSent.Add(int64(n))
+	s.checkMilestones(cs)
+}
+
+// resetOnClose makes the coming close of c, the connection of cs, send an
+// RST instead of a FIN. Only TCP connections are affected; the poller sets
+// SO_LINGER on its own copy of the socket when it sees cs.reset.
+func resetOnClose(c io.Closer, cs *clientState) {
+	cs.reset.Store(true)
+	if conn, ok := c.(net.Conn); ok {
+		if tc, ok := tcpConnOf(conn); ok {
+			tc.SetLinger(0)
+		}
+	}
+}
+
+// nextLine has gen write the next line into buf and records its length.
+func (s *Server) nextLine(gen LineGenerator, buf []byte) int {
+	n := gen.Next(buf)
+	s.lineLengths.Observe(float64(n))
+	return n
+}
+
+// lifetimeExceeded reports whether cs has outlived the configured
+// MaxLifetime.
+func lifetimeExceeded(cs *clientState, config *Config) bool {
+	return config.MaxLifetime > 0 && time.Since(cs.start) >= config.MaxLifetime
+}
+
+// bytesExceeded reports whether cs has been sent the configured MaxBytes.
+func bytesExceeded(cs *clientState, config *Config) bool {
+	return config.MaxBytes > 0 && cs.bytes >= config.MaxBytes
+}
+
+// writeErrorReason is the disconnect reason for a failed write: peer-reset
+// when the client went away (ECONNRESET or EPIPE), write-error for anything
+// else.
+func writeErrorReason(err error) string {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return "peer-reset"
+	}
+	return "write-error"
+}
+
+// lineDelay returns the wait after the latest write to cs, following
+// config.Ramp up to config.Delay. Jitter is applied on top by the caller.
+func lineDelay(cs *clientState, config *Config) time.Duration {
+	return config.Ramp.delay(cs.writes-1, config.Delay)
+}
+
+// nextChunk returns the part of rest to write next: a single byte when
+// dribbling, and never more than what is left of MaxBytes.
+func nextChunk(rest []byte, cs *clientState, config *Config) []byte {
+	if config.Dribble {
+		rest = rest[:1]
+	}
+	if config.MaxBytes > 0 {
+		left := max(config.MaxBytes-cs.bytes, 0)
+		if int64(len(rest)) > left {
+			rest = rest[:left]
+		}
+	}
+	return rest
+}
+
+// beginClient tunes the socket, counts the client in and logs ACCEPT.
+func (s *Server) beginClient(conn net.Conn, conf *atomic.Pointer[Config]) *clientState {
+	// クライアントからは一切読まないので、相手が送ってきたデータを溜め込まないよう
+	// 受信バッファを最小にする。OS によっては下限に丸められる
+	config := conf.Load()
+	tcpConn, isTCP := tcpConnOf(conn)
+	if size := config.ReadBuffer; size > 0 && isTCP {
+		if err := tcpConn.SetReadBuffer(size); err != nil {
+			s.readBufferWarn.Do(func() {
+				logInfo("Warning: SetReadBuffer(%d) failed, further errors are not logged: %v", size, err)
+			})
+		}
+	}
+	readClosed := config.CloseRead && isTCP && tcpConn.CloseRead() == nil
+	if config.KeepAlive > 0 && isTCP {
+		// 長い Delay の間に消えた相手も、次の書き込みを待たずにカーネルが見つける
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(config.KeepAlive)
+	}
+	if config.Nagle && isTCP {
+		tcpConn.SetNoDelay(false)
+	}
+
+	s.countersMu.RLock()
+	s.updatePeak(s.currentClients.Add(1))
+	id := s.totalConnects.Add(1)
+	s.countersMu.RUnlock()
+	s.admitting.Add(-1)
+
+	host, port := splitAddr(conn.RemoteAddr())
+	if host != "" {
+		s.distinct.add(host)
+		if s.ipCounts != nil {
+			s.ipCounts.add(host)
+		}
+	}
+	_, localPort := splitAddr(conn.LocalAddr())
+	remote := conn.RemoteAddr().String()
+	if host != "" {
+		remote = net.JoinHostPort(host, port)
+	}
+	cs := &clientState{
+		conf: conf, id: id, host: host, port: port, remote: remote, localPort: localPort, start: time.Now(),
+		readClosed: readClosed, record: config.ConnRecords,
+		logged: config.LogSample >= 1 || rand.Float64() < config.LogSample,
+	}
+	if s.geoDB != nil {
+		cs.country = s.countryOf(host)
+	}
+
+	if cs.logged && !cs.record {
+		fields := []field{kv("id", id), kv("host", host), kv("port", port), kv("local_port", localPort), kv("clients", s.currentClients.Load())}
+		if s.geoDB != nil {
+			fields = append(fields, kv("country", cs.country))
+		}
+		if f, ok := s.ptrField(host); ok {
+			fields = append(fields, f)
+		}
+		logEvent("ACCEPT", fields...)
+	}
+
+	if s.statsd != nil {
+		s.statsd.count("connections", 1)
+		s.statsd.gauge("clients", s.currentClients.Load())
+	}
+	if s.hooks != nil {
+		s.hooks.fire(hookEvent{Event: "accept", Host: host, Port: port, LocalPort: localPort, Time: cs.start})
+	}
+	return cs
+}
+
+// endClient undoes beginClient once the connection has been closed. reason
+// and any extra fields are logged with DISCONNECT, or with the CONNECTION
+// record when ConnRecords was set, if reason is non-empty. A client that
+// left on its own before a single byte reached it is logged with
+// reason=immediate-drop, even if that showed up as a peer-reset.
+func (s *Server) endClient(cs *clientState, reason string, extra ...field) {
+	duration := time.Since(cs.start)
+	if cs.kicked.Load() {
+		reason, extra = "kicked", nil
+	}
+	// ImmediateDrops は reason=immediate-drop と同じ条件で数える。停止や kick で切った接続は含めない
+	immediate := cs.bytes == 0 && (reason == "" || reason == "peer-reset")
+	s.countersMu.RLock()
+	if cs.bytes > 0 {
+		s.hookedClients.Add(1)
+	} else if immediate {
+		s.immediateDrops.Add(1)
+	}
+	current := s.currentClients.Add(-1)
+	s.countersMu.RUnlock()
+	if immediate {
+		reason = "immediate-drop"
+	}
+	s.connDurations.Observe(duration.Seconds())
+
+	s.releaseIP(cs.host)
+	s.signalSlotFree()
+	s.clientsWG.Done()
+	if s.statsd != nil {
+		s.statsd.count("disconnects", 1)
+		s.statsd.gauge("clients", current)
+	}
+
+	if !cs.logged {
+		return
+	}
+	if cs.record {
+		s.logRecord(cs, duration, reason, extra)
+		return
+	}
+
+	fields := []field{kv("id", cs.id), kv("host", cs.remote)}
+	if f, ok := s.ptrField(cs.host); ok {
+		fields = append(fields, f)
+	}
+	if reason != "" {
+		fields = append(fields, kv("reason", reason))
+		fields = append(fields, extra...)
+	}
+	fields = append(fields, kv("duration", duration.Round(time.Millisecond)), kv("bytes", cs.bytes))
+	logEvent("DISCONNECT", fields...)
+}
+
+// logRecord logs everything known about a finished connection as one
+// CONNECTION event, so that nothing has to be joined across lines.
+func (s *Server) logRecord(cs *clientState, duration time.Duration, reason string, extra []field) {
+	fields := []field{
+		kv("id", cs.id),
+		kv("host", cs.host),
+		kv("port", cs.port),
+		kv("local_port", cs.localPort),
+	}
+	if s.geoDB != nil {
+		fields = append(fields, kv("country", cs.country))
+	}
+	if f, ok := s.ptrField(cs.host); ok {
+		fields = append(fields, f)
+	}
+	fields = append(fields,
+		kv("start", cs.start.UTC().Format(time.RFC3339Nano)),
+		kv("duration", duration.Round(time.Millisecond)),
+		kv("bytes", cs.bytes),
+	)
+	if reason != "" {
+		fields = append(fields, kv("reason", reason))
+		fields = append(fields, extra...)
+	}
+	logEvent("CONNECTION", fields...)
+}
+
+// handleClient feeds lines to conn until the client goes away or ctx is
+// canceled, which is how Shutdown ends the wait between lines.
+func (s *Server) handleClient(ctx context.Context, conn net.Conn, conf *atomic.Pointer[Config]) {
+	cs := s.beginClient(conn, conf)
+	s.track(conn, cs)
+
+	var reason string
+	var extra []field
+	defer func() {
+		s.untrack(conn, cs)
+		conn.Close()
+		s.endClient(cs, reason, extra...)
+	}()
+
+	rng := newConnRand(conf.Load().Seed)
+	lines := newLineGenerator(conf, rng)
+	pending := initialLine(conf.Load())
+	// 行ごとに確保しないよう、接続ごとのバッファを使い回す
+	scratch := make([]byte, MaxLineLengthLimit)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	// まだ送っていない行の残り。Dribble のときは1バイトずつ減っていく
+	var rest []byte
+
+	if config := conf.Load(); config.FirstDelay > 0 {
+		timer.Reset(jitteredDelay(rng, config.FirstDelay, config.Jitter))
+		select {
+		case <-ctx.Done():
+			reason = "shutdown"
+			return
+		case <-timer.C:
+		}
+	}
+
+	for {
+		config := conf.Load()
+		if len(rest) == 0 {
+			if pending != "" {
+				rest = []byte(pending)
+				pending = ""
+			} else {
+				rest = scratch[:s.nextLine(lines, scratch)]
+			}
+		}
+		chunk := nextChunk(rest, cs, config)
+		if s.sendLimiter != nil {
+			// 全体の上限に達していれば、Delay とは別にここで待つ
+			if err := s.sendLimiter.WaitN(ctx, len(chunk)); err != nil {
+				reason = "shutdown"
+				return
+			}
+		}
+
+		// 間隔は書き始めた時点から測り、書き込みが詰まっていた分は次の待ち時間から差し引く
+		writeStart := time.Now()
+		if config.WriteTimeout > 0 {
+			conn.SetWriteDeadline(writeStart.Add(config.WriteTimeout))
+		}
+
+		// 行ごとに1回ずつ書き込むのは意図的。まとめて送ると Delay ごとに1行ずつという間隔が崩れ、
+		// 相手のタイムアウトを引き延ばせなくなる。毎回すぐ送るのでバッファも持たない
+		n, err := conn.Write(chunk)
+		if err != nil {
+			switch {
+			case ctx.Err() != nil:
+				reason = "shutdown"
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				reason = "write-timeout"
+			default:
+				reason = writeErrorReason(err)
+			}
+			return
+		}
+
+		s.addSent(cs, n)
+		rest = rest[n:]
+		if bytesExceeded(cs, config) {
+			reason = "max-bytes"
+			return
+		}
+		if wait := jitteredDelay(rng, lineDelay(cs, config), config.Jitter) - time.Since(writeStart); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				reason = "shutdown"
+				return
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			reason = "shutdown"
+			return
+		}
+
+		if lifetimeExceeded(cs, conf.Load()) {
+			reason = "max-lifetime"
+			extra = []field{kv("seconds", int64(time.Since(cs.start).Seconds()))}
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package orexis
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startServer serves config on a loopback port until the test ends and
+// returns the address to dial.
+func startServer(t *testing.T, config Config) string {
+	t.Helper()
+	srv, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		// 残っている接続は待たずに切る
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		srv.Shutdown(ctx)
+	})
+	return ln.Addr().String()
+}
+
+func TestCloseReadKeepsWriting(t *testing.T) {
+	c := DefaultConfig()
+	c.Delay = 10 * time.Millisecond
+	c.CloseRead = true
+	conn, err := net.Dial("tcp", startServer(t, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 読み側を閉じた後も、相手が何か送ってきても行は届き続ける
+	r := bufio.NewReader(conn)
+	for i := 0; i < 5; i++ {
+		if _, err := conn.Write([]byte("SSH-2.0-test\r\n")); err != nil {
+			t.Fatalf("client write %d: %v", i, err)
+		}
+		if _, err := r.ReadString('\n'); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+	}
+}
+
+// pipeListener hands out the server ends of net.Pipe connections, whose
+// writes block until the other end reads them.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func TestPacingWithSlowReader(t *testing.T) {
+	const delay, perByte, lines = 60 * time.Millisecond, 2 * time.Millisecond, 6
+	c := DefaultConfig()
+	c.Delay = delay
+	c.MinLineLength, c.MaxLineLength = 10, 10
+	srv, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	go srv.Serve(ln)
+	defer func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	ln.conns <- server
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// 1バイトずつ読むので1行の書き込みに約 20ms かかる。その分は次の待ち時間から引かれるので、
+	// 行の間隔は delay+20ms ではなく delay のままになる
+	var starts []time.Time
+	lineStart := true
+	buf := make([]byte, 1)
+	for len(starts) < lines {
+		time.Sleep(perByte)
+		if _, err := client.Read(buf); err != nil {
+			t.Fatalf("line %d: %v", len(starts), err)
+		}
+		if lineStart {
+			starts = append(starts, time.Now())
+		}
+		lineStart = buf[0] == '\n'
+	}
+	interval := starts[lines-1].Sub(starts[0]) / (lines - 1)
+	if interval < delay*9/10 || interval > delay+delay/6 {
+		t.Fatalf("lines started every %v, want about %v", interval, delay)
+	}
+}
+
+// countingConn counts the Write calls that reach the connection, each of
+// which is one write(2) for a line-sized buffer.
+type countingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Conn.Write(p)
+}
+
+// BenchmarkClientWrites compares writing each line straight to the
+// connection, as clients do, with the bufio.Writer flushed after every
+// line that was there before. Both should make one write per line.
+func BenchmarkClientWrites(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		write func(conn io.Writer) func([]byte) error
+	}{
+		{"direct", func(conn io.Writer) func([]byte) error {
+			return func(line []byte) error {
+				_, err := conn.Write(line)
+				return err
+			}
+		}},
+		{"bufio", func(conn io.Writer) func([]byte) error {
+			w := bufio.NewWriter(conn)
+			return func(line []byte) error {
+				if _, err := w.Write(line); err != nil {
+					return err
+				}
+				return w.Flush()
+			}
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer ln.Close()
+			go func() {
+				peer, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer peer.Close()
+				io.Copy(io.Discard, peer)
+			}()
+			dialed, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			conn := &countingConn{Conn: dialed}
+			defer conn.Close()
+
+			c := DefaultConfig()
+			var conf atomic.Pointer[Config]
+			conf.Store(&c)
+			gen := newLineGenerator(&conf, NewSeededRand(1))
+			buf := make([]byte, MaxLineLengthLimit)
+			write := bench.write(conn)
+			for b.Loop() {
+				if err := write(buf[:gen.Next(buf)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/line")
+			b.ReportMetric(float64(conn.writes)/b.Elapsed().Seconds(), "writes/s")
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package orexis
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// ClientInfo describes one trapped client.
+type ClientInfo struct {
+	Host      string
+	Port      string
+	LocalPort string
+	Start     time.Time
+}
+
+// Clients returns the clients currently trapped, oldest first.
+func (s *Server) Clients() []ClientInfo {
+	s.mu.Lock()
+	var clients []ClientInfo
+	for _, byConn := range s.conns {
+		for _, cs := range byConn {
+			clients = append(clients, ClientInfo{Host: cs.host, Port: cs.port, LocalPort: cs.localPort, Start: cs.start})
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(clients, func(a, b ClientInfo) int { return a.Start.Compare(b.Start) })
+	return clients
+}
+
+// clientAges returns how long each currently trapped client has been
+// connected, in seconds.
+func (s *Server) clientAges() []float64 {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ages []float64
+	for _, byConn := range s.conns {
+		for _, cs := range byConn {
+			ages = append(ages, now.Sub(cs.start).Seconds())
+		}
+	}
+	return ages
+}
+
+// Kick closes every trapped client from ip and returns how many there
+// were, 0 if ip is not a valid address. With Config.ResetOnClose they are
+// sent an RST. Each one is cleaned up as usual by its own goroutine or the
+// poller once the next write fails, and logged with reason=kicked.
+func (s *Server) Kick(ip string) int {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return 0
+	}
+	host := canonicalIP(addr).String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byConn := s.conns[host]
+	for c, cs := range byConn {
+		cs.kicked.Store(true)
+		if cs.conf.Load().ResetOnClose {
+			resetOnClose(c, cs)
+		}
+		c.Close()
+	}
+	return len(byConn)
+}
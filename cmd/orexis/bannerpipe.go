@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexryai/orexis"
+	"github.com/nexryai/orexis/internal/eventlog"
+)
+
+const (
+	// パイプから受け取る行数の上限。超えたら古い行から捨てる
+	maxBannerPipeLines = 10000
+	// 開けなかったときに開き直すまでの間隔
+	bannerPipeRetry = time.Second
+)
+
+// bannerPipe holds the lines last read from -banner-pipe. The mutex is
+// held while they are handed to the server, so that a SIGHUP reload does
+// not overwrite newer lines with the ones it read before.
+type bannerPipe struct {
+	path string
+
+	mu    sync.Mutex
+	lines []string
+}
+
+// openBannerPipe checks that path is a named pipe, or "-" for stdin.
+func openBannerPipe(path string) (*bannerPipe, error) {
+	if path != "-" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			return nil, fmt.Errorf("%s is not a named pipe (create it with mkfifo)", path)
+		}
+	}
+	return &bannerPipe{path: path}, nil
+}
+
+// follow reads the pipe until the process exits. Each writer that opens
+// the pipe starts a new list; its lines replace the served ones as they
+// arrive, a burst at a time. When the writer closes the pipe it is opened
+// again for the next one. stdin is read only once.
+func (p *bannerPipe) follow(srv *orexis.Server) {
+	for {
+		r := io.Reader(os.Stdin)
+		if p.path != "-" {
+			// 書き手が開くまでここで止まる
+			f, err := os.Open(p.path)
+			if err != nil {
+				eventlog.Error("Banner pipe", err)
+				time.Sleep(bannerPipeRetry)
+				continue
+			}
+			r = f
+		}
+
+		err := p.readSession(srv, bufio.NewReader(r))
+		if c, ok := r.(io.Closer); ok && p.path != "-" {
+			c.Close()
+		}
+		if err != nil {
+			eventlog.Error("Banner pipe", err)
+		}
+		if p.path == "-" {
+			eventlog.Info("Banner pipe: stdin closed, keeping the last %d lines", len(p.current()))
+			return
+		}
+	}
+}
+
+// readSession reads one writer's lines until EOF.
+func (p *bannerPipe) readSession(srv *orexis.Server, r *bufio.Reader) error {
+	var session []string
+	pending := false
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			session = append(session, line)
+			if len(session) > maxBannerPipeLines {
+				session = session[1:]
+			}
+			pending = true
+		}
+		// まとめて書かれた行は1回で差し替える
+		if pending && (r.Buffered() == 0 || err != nil) {
+			p.set(srv, session)
+			pending = false
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *bannerPipe) set(srv *orexis.Server, lines []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lines = slices.Clone(lines)
+	if err := srv.SetBanner(p.lines); err != nil {
+		eventlog.Error("Banner pipe", err)
+		return
+	}
+	eventlog.Event("BANNER", eventlog.F("source", p.path), eventlog.F("lines", len(p.lines)))
+}
+
+func (p *bannerPipe) current() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lines
+}
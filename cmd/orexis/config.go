@@ -0,0 +1,314 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nexryai/orexis"
+	"github.com/nexryai/orexis/internal/eventlog"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig mirrors the subset of options that can be set from a config
+// file. Pointer fields distinguish "not present" from a zero value.
+type fileConfig struct {
+	Port          *int           `yaml:"port" toml:"port"`
+	Ports         []int          `yaml:"ports" toml:"ports"`
+	Delay         *delayDuration `yaml:"delay" toml:"delay"`
+	MinLineLength *int           `yaml:"min_line_length" toml:"min_line_length"`
+	MaxLineLength *int           `yaml:"max_line_length" toml:"max_line_length"`
+	MaxClients    *int64         `yaml:"max_clients" toml:"max_clients"`
+	BindFamily    *string        `yaml:"bind_family" toml:"bind_family"`
+	Bind          *string        `yaml:"bind" toml:"bind"`
+	// ポートごとに設定を変える場合の一覧。指定すると port と ports の代わりになる
+	Listeners []fileListener `yaml:"listeners" toml:"listeners"`
+}
+
+// delayDuration accepts either a plain integer of milliseconds (matching
+// the -d flag) or a Go duration string such as "10s".
+type delayDuration time.Duration
+
+func (d *delayDuration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := parseDelay(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = delayDuration(v)
+	return nil
+}
+
+func (d *delayDuration) UnmarshalTOML(v any) error {
+	var s string
+	switch v := v.(type) {
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("invalid delay %v: want milliseconds or a duration like 10s", v)
+	}
+	parsed, err := parseDelay(s)
+	if err != nil {
+		return err
+	}
+	*d = delayDuration(parsed)
+	return nil
+}
+
+func parseDelay(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.Atoi(s); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay %q: want milliseconds or a duration like 10s", s)
+	}
+	return d, nil
+}
+
+// loadConfigFile reads a TOML file if path ends in .toml and YAML otherwise.
+// Unknown keys are reported as warnings so that typos don't go unnoticed.
+func loadConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fc fileConfig
+	var unknown []string
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.Decode(string(data), &fc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, key := range md.Undecoded() {
+			unknown = append(unknown, key.String())
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &fc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		unknown, err = unknownYAMLKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, key := range unknown {
+		eventlog.Info("Warning: %s: unknown key %q", path, key)
+	}
+
+	if err := fc.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &fc, nil
+}
+
+// unknownYAMLKeys returns the keys in data that fileConfig has no field
+// for, including those inside listeners entries, named like TOML's
+// undecoded keys (e.g. "listeners.dealy").
+func unknownYAMLKeys(data []byte) ([]string, error) {
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	unknown := unknownKeys(raw, reflect.TypeFor[fileConfig](), "")
+	if entries, ok := raw["listeners"].([]any); ok {
+		for _, entry := range entries {
+			if m, ok := entry.(map[string]any); ok {
+				unknown = append(unknown, unknownKeys(m, reflect.TypeFor[fileListener](), "listeners.")...)
+			}
+		}
+	}
+	slices.Sort(unknown)
+	return slices.Compact(unknown), nil
+}
+
+// unknownKeys returns the keys of raw that t has no yaml tag for, each
+// prefixed with prefix.
+func unknownKeys(raw map[string]any, t reflect.Type, prefix string) []string {
+	known := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		known[t.Field(i).Tag.Get("yaml")] = true
+	}
+
+	var unknown []string
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, prefix+key)
+		}
+	}
+	return unknown
+}
+
+func (fc *fileConfig) validate() error {
+	if fc.Port != nil && (*fc.Port < 0 || *fc.Port > 65535) {
+		return fmt.Errorf("port %d is outside 0-65535", *fc.Port)
+	}
+	for _, p := range fc.Ports {
+		if p < 0 || p > 65535 {
+			return fmt.Errorf("port %d in ports is outside 0-65535", p)
+		}
+	}
+	if fc.Delay != nil && *fc.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if fc.Listeners != nil && (fc.Port != nil || fc.Ports != nil) {
+		return fmt.Errorf("listeners replaces port and ports, set only one of them")
+	}
+	seen := make(map[int]bool)
+	for i, fl := range fc.Listeners {
+		if err := fl.validate(); err != nil {
+			return fmt.Errorf("listeners[%d]: %w", i, err)
+		}
+		if seen[*fl.Port] {
+			return fmt.Errorf("listeners[%d]: port %d is listed twice", i, *fl.Port)
+		}
+		seen[*fl.Port] = true
+	}
+	if fc.MinLineLength != nil && (*fc.MinLineLength < 3 || *fc.MinLineLength > orexis.MaxLineLengthLimit) {
+		return fmt.Errorf("min_line_length %d is outside 3-255", *fc.MinLineLength)
+	}
+	if fc.MaxLineLength != nil && (*fc.MaxLineLength < 3 || *fc.MaxLineLength > orexis.MaxLineLengthLimit) {
+		return fmt.Errorf("max_line_length %d is outside 3-255", *fc.MaxLineLength)
+	}
+	if fc.MaxClients != nil && *fc.MaxClients < 1 {
+		return fmt.Errorf("max_clients must be at least 1")
+	}
+	if fc.BindFamily != nil {
+		switch *fc.BindFamily {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return fmt.Errorf("bind_family %q must be one of tcp, tcp4, tcp6", *fc.BindFamily)
+		}
+	}
+	return nil
+}
+
+// apply copies file values into c, skipping anything whose flag was
+// explicitly set on the command line.
+func (fc *fileConfig) apply(c *options, explicit map[string]bool) {
+	if fc.Port != nil && !explicit["p"] {
+		c.Port = *fc.Port
+	}
+	// -p だけ指定された場合も、ファイルのポート一覧より優先する
+	if fc.Ports != nil && !explicit["ports"] && !explicit["p"] {
+		c.Ports = fc.Ports
+	}
+	if fc.Delay != nil && !explicit["d"] {
+		c.Delay = time.Duration(*fc.Delay)
+	}
+	if fc.MinLineLength != nil && !explicit["min-line-length"] {
+		c.MinLineLength = *fc.MinLineLength
+	}
+	if fc.MaxLineLength != nil && !explicit["l"] {
+		c.MaxLineLength = *fc.MaxLineLength
+	}
+	if fc.MaxClients != nil && !explicit["m"] {
+		c.MaxClients = *fc.MaxClients
+	}
+	// -p や -ports を指定した場合はそちらを優先し、listeners は使わない
+	if fc.Listeners != nil && !explicit["ports"] && !explicit["p"] {
+		c.Listeners = nil
+		for _, fl := range fc.Listeners {
+			c.Listeners = append(c.Listeners, fl.spec())
+		}
+	}
+	if fc.BindFamily != nil && !explicit["4"] && !explicit["6"] {
+		c.BindFamily = *fc.BindFamily
+	}
+	if fc.Bind != nil && !explicit["bind"] {
+		c.Bind = *fc.Bind
+	}
+}
+
+// explicitFlags returns the names of flags that were set on the command line.
+func explicitFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// reloadConfig re-reads path on top of base and hands the result to srv.
+// running is what the listeners were opened with. On any error the running
+// config is left untouched.
+func reloadConfig(srv *orexis.Server, path string, base, running options, explicit map[string]bool) {
+	if path == "" {
+		eventlog.Info("RELOAD skipped: no -config file")
+		return
+	}
+
+	fc, err := loadConfigFile(path)
+	if err != nil {
+		eventlog.Error("Reload", err)
+		return
+	}
+
+	next := base
+	fc.apply(&next, explicit)
+	if err := next.validate(); err != nil {
+		eventlog.Error("Reload", err)
+		return
+	}
+
+	// リスナーは張り直さないので、ポートとアドレスは起動時のまま
+	if !slices.Equal(next.listenPorts(), running.listenPorts()) || next.BindFamily != running.BindFamily || next.Bind != running.Bind {
+		eventlog.Info("RELOAD: port, bind and bind_family changes require a restart, keeping %s %v", running.BindFamily, running.listenAddrs())
+	}
+	if !reflect.DeepEqual(next.Listeners, running.Listeners) {
+		eventlog.Info("RELOAD: listeners changes require a restart, keeping the per-port settings from startup")
+	}
+
+	if p := next.BannerPipe; p != nil {
+		// パイプからの差し替えと入れ違いで古い行に戻さないよう、Reload が終わるまで押さえる
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.lines != nil {
+			next.Banner = p.lines
+		}
+	}
+	if err := srv.Reload(next.Config); err != nil {
+		eventlog.Error("Reload", err)
+		return
+	}
+	warnLowDelay("delay", next.Delay)
+}
+
+// parsePorts parses a comma-separated port list such as "22,2222,23".
+func parsePorts(spec string) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var ports []int
+	for _, field := range strings.Split(spec, ",") {
+		p, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || p < 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// validate checks the listening settings. The tarpit settings are checked
+// by orexis.New and Server.Reload.
+func (o *options) validate() error {
+	for _, p := range o.listenPorts() {
+		if p < 0 || p > 65535 {
+			return fmt.Errorf("port %d is outside 0-65535", p)
+		}
+	}
+	return nil
+}
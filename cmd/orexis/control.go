@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nexryai/orexis"
+	"github.com/nexryai/orexis/internal/eventlog"
+)
+
+// serveControl listens on spec, which must be "unix:/path", and answers
+// the control commands in the background until the returned listener is
+// passed to closeControl. The socket is made accessible to its owner only
+// from the moment it exists, which is all the authentication there is.
+func serveControl(spec string, srv *orexis.Server) (net.Listener, error) {
+	path, ok := strings.CutPrefix(spec, "unix:")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("%q: want unix:/path", spec)
+	}
+	ln, err := listenPrivateUnix(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				eventlog.Error("Control", err)
+				return
+			}
+			go handleControl(conn, srv)
+		}
+	}()
+
+	eventlog.Info("Control listening on unix %s", path)
+	return ln, nil
+}
+
+// closeControl stops the control listener and removes its socket file.
+func closeControl(ln net.Listener) {
+	path := ln.Addr().String()
+	ln.Close()
+	// Close も消そうとするが、-user で権限を落とした後は失敗しても黙っている
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		eventlog.Error("Control", err)
+	}
+}
+
+// handleControl runs one control session: a command per line, each answered
+// with zero or more lines and then "OK" or "ERR message".
+func handleControl(conn net.Conn, srv *orexis.Server) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if err := runControl(conn, srv, cmd, strings.TrimSpace(arg)); err != nil {
+			fmt.Fprintf(conn, "ERR %v\n", err)
+		} else {
+			fmt.Fprintln(conn, "OK")
+		}
+	}
+}
+
+func runControl(w io.Writer, srv *orexis.Server, cmd, arg string) error {
+	switch cmd {
+	case "stats":
+		st := srv.Stats()
+		fmt.Fprintf(w, "current=%d peak=%d total=%d rejected=%d bytes=%d bytes_per_sec=%d\n",
+			st.CurrentClients, st.PeakClients, st.TotalConnects, st.RejectedConnects, st.BytesSent, st.BytesPerSec)
+	case "list":
+		now := time.Now()
+		for _, c := range srv.Clients() {
+			fmt.Fprintf(w, "host=%s port=%s local_port=%s duration=%v\n", c.Host, c.Port, c.LocalPort, now.Sub(c.Start).Round(time.Second))
+		}
+	case "kick":
+		if _, err := netip.ParseAddr(arg); err != nil {
+			return fmt.Errorf("kick: want an IP address")
+		}
+		n := srv.Kick(arg)
+		eventlog.Info("Control: kicked %d clients from %s", n, arg)
+		fmt.Fprintf(w, "kicked=%d\n", n)
+	default:
+		return fmt.Errorf("unknown command %q (want stats, list or kick <ip>)", cmd)
+	}
+	return nil
+}
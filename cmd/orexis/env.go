@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envPrefix = "OREXIS_"
+
+// 1文字のフラグは環境変数名だと分かりにくいので別名を付ける
+var envNames = map[string]string{
+	"p": "PORT",
+	"d": "DELAY_MS",
+	"l": "MAX_LINE_LENGTH",
+	"m": "MAX_CLIENTS",
+	"4": "IPV4",
+	"6": "IPV6",
+}
+
+// envName returns the environment variable for a flag, e.g. OREXIS_PER_IP
+// for -per-ip, or "" for flags that cannot be set from the environment.
+func envName(flagName string) string {
+	if flagName == "h" || flagName == "version" {
+		return ""
+	}
+	if name, ok := envNames[flagName]; ok {
+		return envPrefix + name
+	}
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag that was not given on the command line from its
+// OREXIS_* variable. It must run after flag.Parse and before explicitFlags,
+// which gives the precedence flags > environment > config file > defaults:
+// a flag set here counts as explicit, so the config file leaves it alone.
+func applyEnv() error {
+	explicit := explicitFlags()
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		if err != nil || name == "" || explicit[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if f.Name == "d" {
+			// -d と同じミリ秒の整数に加えて、10s のような期間も受け付ける
+			d, perr := parseDelay(value)
+			if perr != nil {
+				err = fmt.Errorf("%s: %w", name, perr)
+				return
+			}
+			value = strconv.FormatInt(int64(d/time.Millisecond), 10)
+		}
+		if serr := flag.Set(f.Name, value); serr != nil {
+			err = fmt.Errorf("%s: %w", name, serr)
+		}
+	})
+	return err
+}
+
+// usage is flag.Usage with a note on the environment variables.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nEvery flag except -h and -version can also be set as %s<NAME>, e.g. %s for -d or %s for -per-ip.\n", envPrefix, envName("d"), envName("per-ip"))
+	fmt.Fprintln(out, "Flags take precedence over the environment, which takes precedence over -config.")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvPrecedence(t *testing.T) {
+	saved := flag.CommandLine
+	defer func() { flag.CommandLine = saved }()
+	flag.CommandLine = flag.NewFlagSet("orexis", flag.ContinueOnError)
+
+	port := flag.Int("p", DefaultPort, "")
+	delayMs := flag.Int("d", 10000, "")
+	minLineLen := flag.Int("min-line-length", 3, "")
+	maxLineLen := flag.Int("l", 32, "")
+	maxClients := flag.Int64("m", 4096, "")
+	if err := flag.CommandLine.Parse([]string{"-l", "40"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OREXIS_MAX_LINE_LENGTH", "50")
+	t.Setenv("OREXIS_MIN_LINE_LENGTH", "10")
+	t.Setenv("OREXIS_DELAY_MS", "2s")
+	path := filepath.Join(t.TempDir(), "orexis.yaml")
+	data := "max_line_length: 60\nmin_line_length: 20\ndelay: 5s\nmax_clients: 7\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	var opts options
+	opts.Port = *port
+	opts.Delay = time.Duration(*delayMs) * time.Millisecond
+	opts.MinLineLength = *minLineLen
+	opts.MaxLineLength = *maxLineLen
+	opts.MaxClients = *maxClients
+	fc, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc.apply(&opts, explicitFlags())
+
+	// フラグ > 環境変数 > 設定ファイル > デフォルト
+	if opts.MaxLineLength != 40 {
+		t.Errorf("max line length %d, want 40 from the flag", opts.MaxLineLength)
+	}
+	if opts.MinLineLength != 10 || opts.Delay != 2*time.Second {
+		t.Errorf("min line length %d and delay %v, want 10 and 2s from the environment", opts.MinLineLength, opts.Delay)
+	}
+	if opts.MaxClients != 7 {
+		t.Errorf("max clients %d, want 7 from the file", opts.MaxClients)
+	}
+	if opts.Port != DefaultPort {
+		t.Errorf("port %d, want the default %d", opts.Port, DefaultPort)
+	}
+}
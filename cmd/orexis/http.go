@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/nexryai/orexis/internal/eventlog"
+)
+
+// serveHTTP binds addr synchronously so a bad address fails at startup,
+// then serves handler in the background. name is used in log lines.
+func serveHTTP(name, addr string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := http.Serve(ln, handler); err != nil {
+			eventlog.Error(name+" server", err)
+		}
+	}()
+
+	eventlog.Info("%s listening on %s", name, ln.Addr())
+	return nil
+}
+
+// pprofHandler exposes net/http/pprof on its own mux, so profiling is only
+// reachable on the address given to -pprof-addr.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/nexryai/orexis"
+)
+
+// listenerSpec is one entry of the config file's listeners list: a port
+// whose clients get their own delay, line length or banner on top of the
+// global settings.
+type listenerSpec struct {
+	Port          int
+	Delay         *time.Duration
+	MaxLineLength *int
+	BannerFile    string
+}
+
+// fileListener is how a listenerSpec is written in the config file.
+type fileListener struct {
+	Port          *int           `yaml:"port" toml:"port"`
+	Delay         *delayDuration `yaml:"delay" toml:"delay"`
+	MaxLineLength *int           `yaml:"max_line_length" toml:"max_line_length"`
+	BannerFile    string         `yaml:"banner_file" toml:"banner_file"`
+}
+
+func (fl fileListener) validate() error {
+	if fl.Port == nil {
+		return fmt.Errorf("port is required")
+	}
+	if *fl.Port < 0 || *fl.Port > 65535 {
+		return fmt.Errorf("port %d is outside 0-65535", *fl.Port)
+	}
+	if fl.Delay != nil && *fl.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if fl.MaxLineLength != nil && (*fl.MaxLineLength < 3 || *fl.MaxLineLength > orexis.MaxLineLengthLimit) {
+		return fmt.Errorf("max_line_length %d is outside 3-255", *fl.MaxLineLength)
+	}
+	return nil
+}
+
+func (fl fileListener) spec() listenerSpec {
+	ls := listenerSpec{Port: *fl.Port, MaxLineLength: fl.MaxLineLength, BannerFile: fl.BannerFile}
+	if fl.Delay != nil {
+		d := time.Duration(*fl.Delay)
+		ls.Delay = &d
+	}
+	return ls
+}
+
+// overrides turns ls into what Server.ServeWith takes, reading its banner
+// file.
+func (ls listenerSpec) overrides() (orexis.Overrides, error) {
+	o := orexis.Overrides{Delay: ls.Delay, MaxLineLength: ls.MaxLineLength}
+	if ls.BannerFile != "" {
+		lines, err := orexis.LoadBannerFile(ls.BannerFile)
+		if err != nil {
+			return o, fmt.Errorf("listener %d: %w", ls.Port, err)
+		}
+		o.Banner = lines
+	}
+	return o, nil
+}
+
+// validateListeners checks every listeners entry against the merged
+// configuration, so that a bad override stops startup before any port is
+// reported as listening instead of failing in ServeWith later.
+func (o *options) validateListeners() error {
+	for _, ls := range o.Listeners {
+		ov, err := ls.overrides()
+		if err != nil {
+			return err
+		}
+		if err := ov.Validate(o.Config); err != nil {
+			return fmt.Errorf("listener %d: %w", ls.Port, err)
+		}
+	}
+	return nil
+}
+
+// listenerOverrides returns the Overrides for every listener whose port
+// has a listenerSpec. Listeners on other ports use the global settings.
+func (o *options) listenerOverrides(listeners []net.Listener) (map[net.Listener]orexis.Overrides, error) {
+	byPort := make(map[int]listenerSpec)
+	for _, ls := range o.Listeners {
+		byPort[ls.Port] = ls
+	}
+
+	result := make(map[net.Listener]orexis.Overrides)
+	for _, ln := range listeners {
+		addr, ok := ln.Addr().(*net.TCPAddr)
+		if !ok {
+			continue
+		}
+		ls, ok := byPort[addr.Port]
+		if !ok {
+			continue
+		}
+		ov, err := ls.overrides()
+		if err != nil {
+			return nil, err
+		}
+		result[ln] = ov
+	}
+	return result, nil
+}
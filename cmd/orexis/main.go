@@ -0,0 +1,649 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nexryai/orexis"
+	"github.com/nexryai/orexis/internal/eventlog"
+)
+
+const (
+	DefaultPort          = 2222
+	DefaultShutdownGrace = 10 * time.Second
+	// -max-clients-auto で MaxClients に回す fd の割合 (%)。残りはログやメトリクスなどのため
+	autoMaxClientsPercent = 80
+	// これより短い Delay ではほぼ垂れ流しになり、タールピットとして働かない
+	minEffectiveDelay = 100 * time.Millisecond
+)
+
+// options is everything the command line controls: the tarpit settings
+// handed to orexis.New, plus where to listen and which side endpoints to
+// serve.
+type options struct {
+	orexis.Config
+
+	Port int
+	// 複数のポートで待ち受ける場合のポート一覧。空なら Port だけを使う
+	Ports      []int
+	BindFamily string
+	// 設定ファイルの listeners。空でなければ Port と Ports の代わりにこのポートで待ち受ける
+	Listeners []listenerSpec
+	// 待ち受けるアドレス。空なら全インターフェース
+	Bind string
+	// BindFamily が tcp のとき IPv6 のソケットで IPv4 も受ける (IPV6_V6ONLY を外す)。OS の既定に任せない
+	DualStack bool
+	// SO_REUSEPORT を付けて、同じポートで複数のプロセスが待ち受けられるようにする
+	ReusePort bool
+	// 1ポートあたりのリスナー数。2 以上なら SO_REUSEPORT でカーネルに振り分けさせ、Accept を並列にする
+	Acceptors int
+	// 0 より大きければ TCP の listen バックログ (0 なら somaxconn のまま)
+	Backlog int
+	// nil でなければ -banner-pipe から読んだ行を Banner の代わりに使う。リロードでも引き継ぐ
+	BannerPipe *bannerPipe
+	// 空でなければ TCP の代わりにこのパスの Unix ドメインソケットで待ち受ける
+	UnixSocket string
+	// 0 でなければこのポートへの接続を knock として受け付け、送信元を KnockTTL の間タールピットから外す
+	KnockPort int
+	// 空でなければ Prometheus 形式のメトリクスを公開する
+	MetricsAddr string
+	// 空でなければ /healthz と /readyz を公開する
+	HealthAddr string
+	// 空でなければ net/http/pprof を公開する
+	PprofAddr string
+	// 空でなければこの Unix ソケットで stats、list、kick を受け付ける
+	Control string
+	// 空でなければ待ち受けを始めた後にこのユーザーとグループに切り替える
+	User  string
+	Group string
+	// 停止シグナル受信後、既存の接続を強制切断するまでの猶予
+	ShutdownTimeout time.Duration
+}
+
+func main() {
+	port := flag.Int("p", DefaultPort, "Listening port")
+	ports := flag.String("ports", "", "Comma-separated list of listening ports (overrides -p)")
+	delayMs := flag.Int("d", int(orexis.DefaultDelay/time.Millisecond), "Message millisecond delay")
+	minLineLen := flag.Int("min-line-length", orexis.DefaultMinLineLength, "Minimum random line length (3 up to -l)")
+	maxLineLen := flag.Int("l", orexis.DefaultMaxLineLength, "Maximum banner line length (3-255)")
+	maxClients := flag.Int64("m", orexis.DefaultMaxClients, "Maximum number of clients")
+	maxClientsAuto := flag.Bool("max-clients-auto", false, "Set -m to 80% of the open file limit (RLIMIT_NOFILE) instead")
+	pauseAtMax := flag.Bool("pause-at-max", false, "At -m clients, stop accepting and leave new clients in the listen backlog instead of closing them")
+	maxBPS := flag.Int64("max-bps", 0, "Cap on bytes per second sent to all clients together; writers wait when it is reached (0 = unlimited)")
+	acceptRate := flag.Float64("accept-rate", 0, "Maximum new connections admitted per second (0 = unlimited)")
+	perIP := flag.Int("per-ip", 0, "Maximum concurrent clients per source IP (0 = unlimited)")
+	perIPRate := flag.Float64("per-ip-rate", 0, "Maximum new connections admitted per second from one source IP (0 = unlimited)")
+	bind := flag.String("bind", "", "Address to listen on (default all interfaces)")
+	useV4 := flag.Bool("4", false, "Bind to IPv4 only")
+	useV6 := flag.Bool("6", false, "Bind to IPv6 only")
+	dualStack := flag.Bool("dualstack", true, "With neither -4 nor -6, accept IPv4 on IPv6 sockets too by clearing IPV6_V6ONLY; false sets it, so an IPv6 wildcard bind accepts IPv6 only (Unix only)")
+	reusePort := flag.Bool("reuseport", false, "Set SO_REUSEPORT so several orexis processes can share the port (Unix except Solaris and illumos)")
+	acceptors := flag.Int("acceptors", 1, "Listeners (each with its own accept loop) per port, sharing it with SO_REUSEPORT (Unix except Solaris and illumos)")
+	backlog := flag.Int("backlog", 0, "TCP listen backlog (0 = the system's somaxconn; Linux and BSD only, ignored with a warning elsewhere)")
+	unixPath := flag.String("unix", "", "Listen on this Unix domain socket instead of TCP")
+	proxyProtocol := flag.Bool("proxy-protocol", false, "Expect a PROXY protocol v1 header on each connection")
+	tlsCert := flag.String("tls-cert", "", "Certificate file; with -tls-key, speak TLS and send the junk inside it")
+	tlsKey := flag.String("tls-key", "", "Private key file for -tls-cert")
+	milestones := flag.String("milestones", orexis.DefaultMilestones, "Log MILESTONE when a client has been trapped for each of these comma-separated durations (\"off\" for none)")
+	rampSpec := flag.String("ramp", "", "Start each client with a short delay growing to -d: linear:START:STEP (e.g. linear:200ms:500ms) or exp:START:FACTOR (e.g. exp:100ms:2)")
+	firstDelay := flag.Duration("first-delay", 0, "Wait before the first line, independent of -d (jittered like -d)")
+	handshakeTimeout := flag.Duration("handshake-timeout", orexis.DefaultHandshakeTimeout, "Time allowed for reading the PROXY header, the TLS handshake, -peek and -wait-for-client before the first line (0 = unlimited)")
+	peek := flag.Duration("peek", 0, "Wait this long for the client to talk first and log CLIENTDATA with how much it sent and CLIENTBANNER with its first line (0 = off)")
+	waitForClient := flag.Bool("wait-for-client", false, "Stay silent until the client sends its SSH identification line, log it as CLIENTBANNER, then start writing; clients silent past -handshake-timeout are dropped")
+	seed := flag.Int64("seed", 0, "Seed the line generator for reproducible output (0 = random per connection)")
+	style := flag.String("style", orexis.StyleRandom, "Look of random lines: random, or wordlike for letter words separated by spaces")
+	excludeBytes := flag.String("exclude-bytes", "", "Bytes never to use in random lines, e.g. '\"\\' for double quotes and backslashes")
+	chaos := flag.Bool("chaos", false, "Occasionally mix ANSI escape sequences (cursor moves, clears, colours) into random lines to garble terminal-based scanners")
+	charset := flag.String("charset", orexis.CharsetASCII, "Characters for random lines: ascii, printable-latin1 or utf8")
+	terminator := flag.String("terminator", orexis.TerminatorCRLF, "Line ending: crlf, lf or none (one endless line)")
+	readBuffer := flag.Int("read-buffer", 1, "SO_RCVBUF for trapped clients in bytes (0 = leave the OS default)")
+	closeRead := flag.Bool("close-read", false, "Shut down the read half of each TCP client right after accept")
+	dribble := flag.Bool("dribble", false, "Send one byte per delay instead of one line")
+	jitter := flag.Int("jitter", 0, "Randomize each delay by up to this percentage (0-100)")
+	noDelay := flag.Bool("nodelay", true, "Set TCP_NODELAY on trapped clients so every line, or byte with -dribble, goes out at once; -nodelay=false turns Nagle's algorithm on")
+	keepAlive := flag.Duration("keepalive", 0, "Enable TCP keepalive with this period on trapped clients (0 = leave the default)")
+	writeTimeout := flag.Duration("write-timeout", orexis.DefaultWriteTimeout, "Drop clients whose writes block longer than this (0 = never)")
+	maxLifetime := flag.Duration("max-lifetime", 0, "Close clients after they have been trapped this long (0 = unlimited)")
+	maxBytes := flag.Int64("max-bytes", 0, "Close clients after sending them this many bytes (0 = unlimited)")
+	allow := flag.String("allow", "", "Comma-separated CIDRs that bypass the tarpit")
+	allowFile := flag.String("allow-file", "", "File of CIDRs, one per line, that bypass the tarpit")
+	knockPort := flag.Int("knock-port", 0, "Secret port: a connection to it lets the source IP bypass the tarpit for -knock-ttl (0 = off)")
+	knockTTL := flag.Duration("knock-ttl", orexis.DefaultKnockTTL, "How long an IP that connected to -knock-port bypasses the tarpit")
+	deny := flag.String("deny", "", "Comma-separated CIDRs to drop without tarpitting (takes precedence over -allow)")
+	denyFile := flag.String("deny-file", "", "File of CIDRs, one per line, to drop without tarpitting")
+	bannerFile := flag.String("banner-file", "", "Serve lines from this file in a loop instead of random data")
+	bannerPipePath := flag.String("banner-pipe", "", "Keep reading lines from this named pipe (or - for stdin); each writer's lines replace the served ones as they arrive")
+	sshBanner := flag.String("ssh-banner", "", "Send this SSH version string (e.g. SSH-2.0-OpenSSH_8.9) as the first line")
+	geoIPPath := flag.String("geoip", "", "Path to a MaxMind GeoLite2-Country database; adds country= to ACCEPT")
+	resolve := flag.Bool("resolve", false, "Add the reverse DNS name of each client as ptr= once known (looked up in the background, cached)")
+	onAcceptExec := flag.String("on-accept-exec", "", "Run this command (split on spaces, no shell) for every accepted client; {ip} is replaced with its address")
+	webhookURL := flag.String("webhook-url", "", "POST a JSON event to this URL for every accepted client")
+	usePoll := flag.Bool("poll", false, "Drive all clients from a single epoll loop (Linux only)")
+	statsInterval := flag.Duration("stats-interval", orexis.DefaultStatsInterval, "How often to log STATS (0 = only at shutdown)")
+	stateFile := flag.String("state-file", "", "Keep TotalConnects and TotalBytesSent in this JSON file across restarts")
+	topIPs := flag.Int("top-ips", 0, "With each periodic STATS line, log the N sources that connected most often as TOPIPS (0 = off)")
+	rollingPeak := flag.Bool("rolling-peak", false, "Report PeakClients since the previous STATS line instead of since start")
+	statsdAddr := flag.String("statsd-addr", "", "Send connection counts and bytes to this statsd server over UDP (e.g. 127.0.0.1:8125)")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address (e.g. :9100)")
+	healthAddr := flag.String("health-addr", "", "Serve /healthz and /readyz on this address")
+	control := flag.String("control", "", "Accept stats, list and kick <ip> commands on this socket (unix:/path, owner-only)")
+	pprofAddr := flag.String("pprof-addr", "", "Serve net/http/pprof on this address (off by default; keep it private)")
+	rstOnClose := flag.Bool("rst-on-close", false, "Close the clients forced out at shutdown or kicked with a TCP RST instead of a FIN, like a crashed server")
+	shutdownTimeout := flag.Duration("shutdown-timeout", DefaultShutdownGrace, "Grace period for trapped clients before forcing them closed on shutdown")
+	userName := flag.String("user", "", "Switch to this user (name or uid) once listening, e.g. after binding port 22 as root")
+	groupName := flag.String("group", "", "Switch to this group (name or gid) once listening (default the -user's primary group)")
+	configPath := flag.String("config", "", "Path to a YAML or .toml config file (flags override file values)")
+	connRecords := flag.Bool("conn-records", false, "Log one CONNECTION record per client when it leaves instead of ACCEPT and DISCONNECT")
+	logFile := flag.String("log-file", "", "Write logs to this file instead of stdout")
+	logMaxSize := flag.Int64("log-max-size", 100, "Rotate -log-file once it reaches this many megabytes (0 = never)")
+	logMaxBackups := flag.Int("log-max-backups", 5, "Rotated -log-file copies to keep as FILE.1, FILE.2, ...")
+	logSample := flag.Float64("log-sample", 1, "Fraction of clients (0.0-1.0) whose ACCEPT and DISCONNECT are logged; stats still count all")
+	logFormat := flag.String("log-format", orexis.LogFormatText, "Log format: text or json")
+	help := flag.Bool("h", false, "Print this help message")
+	showVersion := flag.Bool("version", false, "Print the version, commit and Go version and exit")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+	if *showVersion {
+		fmt.Println(versionLine())
+		os.Exit(0)
+	}
+
+	if err := applyEnv(); err != nil {
+		log.Fatalf("Fatal: env: %v", err)
+	}
+
+	network := "tcp"
+	if *useV4 {
+		network = "tcp4"
+	} else if *useV6 {
+		network = "tcp6"
+	}
+
+	portList, err := parsePorts(*ports)
+	if err != nil {
+		log.Fatalf("Fatal: ports: %v", err)
+	}
+
+	opts := options{
+		Config: orexis.Config{
+			Delay:            time.Duration(*delayMs) * time.Millisecond,
+			MinLineLength:    *minLineLen,
+			MaxLineLength:    *maxLineLen,
+			MaxClients:       *maxClients,
+			PauseAtMax:       *pauseAtMax,
+			KnockTTL:         *knockTTL,
+			AcceptRate:       *acceptRate,
+			MaxBPS:           *maxBPS,
+			PerIPLimit:       *perIP,
+			PerIPRate:        *perIPRate,
+			ProxyProtocol:    *proxyProtocol,
+			HandshakeTimeout: *handshakeTimeout,
+			Peek:             *peek,
+			WaitForClient:    *waitForClient,
+			FirstDelay:       *firstDelay,
+			Seed:             *seed,
+			Charset:          *charset,
+			Chaos:            *chaos,
+			ExcludeBytes:     *excludeBytes,
+			Style:            *style,
+			Terminator:       *terminator,
+			ReadBuffer:       *readBuffer,
+			CloseRead:        *closeRead,
+			Dribble:          *dribble,
+			Jitter:           *jitter,
+			KeepAlive:        *keepAlive,
+			Nagle:            !*noDelay,
+			WriteTimeout:     *writeTimeout,
+			ResetOnClose:     *rstOnClose,
+			MaxLifetime:      *maxLifetime,
+			MaxBytes:         *maxBytes,
+			SSHBanner:        *sshBanner,
+			Poll:             *usePoll,
+			StatsInterval:    *statsInterval,
+			StateFile:        *stateFile,
+			TopIPs:           *topIPs,
+			RollingPeak:      *rollingPeak,
+			ConnRecords:      *connRecords,
+			LogSample:        *logSample,
+			GeoIPPath:        *geoIPPath,
+			Resolve:          *resolve,
+			OnAcceptExec:     *onAcceptExec,
+			WebhookURL:       *webhookURL,
+			StatsdAddr:       *statsdAddr,
+		},
+		Port:            *port,
+		Ports:           portList,
+		BindFamily:      network,
+		Bind:            *bind,
+		DualStack:       *dualStack,
+		ReusePort:       *reusePort,
+		Backlog:         *backlog,
+		Acceptors:       *acceptors,
+		KnockPort:       *knockPort,
+		UnixSocket:      *unixPath,
+		MetricsAddr:     *metricsAddr,
+		HealthAddr:      *healthAddr,
+		PprofAddr:       *pprofAddr,
+		Control:         *control,
+		User:            *userName,
+		Group:           *groupName,
+		ShutdownTimeout: *shutdownTimeout,
+	}
+
+	if err := orexis.SetLogFormat(*logFormat); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if *logFile != "" {
+		if *logMaxSize < 0 || *logMaxBackups < 0 {
+			eventlog.Fatal("-log-max-size and -log-max-backups must not be negative")
+		}
+		if err := eventlog.SetFile(*logFile, *logMaxSize<<20, *logMaxBackups); err != nil {
+			eventlog.Fatal("log file: %v", err)
+		}
+	}
+
+	if opts.Acceptors < 1 {
+		eventlog.Fatal("-acceptors must be at least 1")
+	}
+	if opts.Acceptors > 1 && !reusePortSupported {
+		eventlog.Info("Warning: -acceptors needs SO_REUSEPORT, which this platform lacks; using 1")
+		opts.Acceptors = 1
+	}
+
+	if *tlsCert != "" || *tlsKey != "" {
+		if *tlsCert == "" || *tlsKey == "" {
+			eventlog.Fatal("-tls-cert and -tls-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			eventlog.Fatal("tls: %v", err)
+		}
+		opts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	opts.Milestones, err = orexis.ParseMilestones(*milestones)
+	if err != nil {
+		eventlog.Fatal("%v", err)
+	}
+
+	ramp, err := orexis.ParseRamp(*rampSpec)
+	if err != nil {
+		eventlog.Fatal("%v", err)
+	}
+	opts.Ramp = ramp
+
+	allowList, err := orexis.ParseIPList(*allow, *allowFile)
+	if err != nil {
+		eventlog.Fatal("allow: %v", err)
+	}
+	opts.Allow = allowList
+
+	denyList, err := orexis.ParseIPList(*deny, *denyFile)
+	if err != nil {
+		eventlog.Fatal("deny: %v", err)
+	}
+	opts.Deny = denyList
+
+	if *bannerFile != "" {
+		lines, err := orexis.LoadBannerFile(*bannerFile)
+		if err != nil {
+			eventlog.Fatal("banner: %v", err)
+		}
+		if len(lines) == 0 {
+			eventlog.Info("Warning: banner file %s is empty, falling back to random lines", *bannerFile)
+		}
+		opts.Banner = lines
+	}
+	if *bannerPipePath != "" {
+		p, err := openBannerPipe(*bannerPipePath)
+		if err != nil {
+			eventlog.Fatal("banner pipe: %v", err)
+		}
+		opts.BannerPipe = p
+	}
+
+	// 失敗しても起動は続ける。足りなければ下の MaxClients の確認で警告が出る
+	fdBefore, fdAfter, fdErr := raiseFDLimit()
+	if fdErr == nil && fdAfter > fdBefore {
+		eventlog.Info("Raised the open file limit from %d to %d", fdBefore, fdAfter)
+	} else if fdErr != nil {
+		eventlog.Info("Warning: could not raise the open file limit: %v", fdErr)
+	}
+
+	if *maxClientsAuto {
+		if limit, err := fdLimit(); err != nil {
+			eventlog.Info("Warning: -max-clients-auto: %v, keeping MaxClients=%d", err, opts.MaxClients)
+			*maxClientsAuto = false
+		} else {
+			opts.MaxClients = max(1, int64(min(limit, math.MaxInt64/100)*autoMaxClientsPercent/100))
+			eventlog.Info("MaxClients=%d from %d%% of the open file limit %d", opts.MaxClients, autoMaxClientsPercent, limit)
+		}
+	}
+
+	// リロード時はフラグとデフォルトだけの状態からファイルを適用し直す
+	baseOpts := opts
+	explicit := explicitFlags()
+	if *maxClientsAuto {
+		// 設定ファイルの max_clients より優先する
+		explicit["m"] = true
+	}
+	if *configPath != "" {
+		fc, err := loadConfigFile(*configPath)
+		if err != nil {
+			eventlog.Fatal("config: %v", err)
+		}
+		fc.apply(&opts, explicit)
+	}
+	if err := opts.validate(); err != nil {
+		eventlog.Fatal("config: %v", err)
+	}
+	if err := opts.validateListeners(); err != nil {
+		eventlog.Fatal("config: %v", err)
+	}
+	if explicit["dualstack"] && opts.BindFamily != "tcp" {
+		eventlog.Fatal("-dualstack only applies to bind family tcp, not %s", opts.BindFamily)
+	}
+	if limit, err := fdLimit(); err == nil && uint64(opts.MaxClients) > limit*autoMaxClientsPercent/100 {
+		eventlog.Info("Warning: MaxClients=%d leaves little or no headroom under the open file limit %d; accepts may fail with EMFILE (see -max-clients-auto)", opts.MaxClients, limit)
+	}
+
+	srv, err := orexis.New(opts.Config)
+	if err != nil {
+		eventlog.Fatal("%v", err)
+	}
+
+	if opts.MetricsAddr != "" {
+		if err := serveHTTP("Metrics", opts.MetricsAddr, srv.MetricsHandler()); err != nil {
+			eventlog.Fatal("metrics: %v", err)
+		}
+	}
+
+	if opts.HealthAddr != "" {
+		if err := serveHTTP("Health", opts.HealthAddr, srv.HealthHandler()); err != nil {
+			eventlog.Fatal("health: %v", err)
+		}
+	}
+
+	// 攻撃者に晒されるサービスなので、明示的に指定されたときだけ待ち受ける
+	if opts.PprofAddr != "" {
+		if err := serveHTTP("pprof", opts.PprofAddr, pprofHandler()); err != nil {
+			eventlog.Fatal("pprof: %v", err)
+		}
+	}
+
+	var controlLn net.Listener
+	if opts.Control != "" {
+		controlLn, err = serveControl(opts.Control, srv)
+		if err != nil {
+			eventlog.Fatal("control: %v", err)
+		}
+	}
+
+	listeners, err := opts.listen()
+	if err != nil {
+		eventlog.Fatal("%v", err)
+	}
+	if opts.KnockPort != 0 {
+		host := strings.TrimSuffix(strings.TrimPrefix(opts.Bind, "["), "]")
+		kln, err := net.Listen(opts.BindFamily, net.JoinHostPort(host, strconv.Itoa(opts.KnockPort)))
+		if err != nil {
+			eventlog.Fatal("knock: %v", err)
+		}
+		eventlog.Info("Knock port %s open, bypass TTL %v", kln.Addr(), opts.KnockTTL)
+		go func() {
+			if err := srv.ServeKnock(kln); !errors.Is(err, orexis.ErrServerClosed) {
+				eventlog.Error("Knock accept", err)
+			}
+		}()
+	}
+
+	if opts.User != "" || opts.Group != "" {
+		if err := dropPrivileges(opts.User, opts.Group); err != nil {
+			eventlog.Fatal("drop privileges: %v", err)
+		}
+		eventlog.Info("Dropped privileges to uid=%d gid=%d", os.Getuid(), os.Getgid())
+		if *logFile != "" {
+			// 回すときはディレクトリでリネームと作成をするので、落とした後の権限で確かめる
+			if err := logDirWritable(*logFile); err != nil {
+				if *logMaxSize > 0 {
+					eventlog.Fatal("log rotation (-log-max-size) cannot work for %s after -user/-group: %v", *logFile, err)
+				}
+				eventlog.Info("Warning: %v; reopening %s on SIGUSR1 fails if it has been moved away", err, *logFile)
+			}
+		}
+	}
+
+	overrides, err := opts.listenerOverrides(listeners)
+	if err != nil {
+		eventlog.Fatal("%v", err)
+	}
+
+	opts.logSummary()
+	warnLowDelay("delay", opts.Delay)
+	for _, ls := range opts.Listeners {
+		if ls.Delay != nil {
+			warnLowDelay(fmt.Sprintf("listener %d delay", ls.Port), *ls.Delay)
+		}
+	}
+
+	if opts.BannerPipe != nil {
+		go opts.BannerPipe.follow(srv)
+	}
+
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			reloadConfig(srv, *configPath, baseOpts, opts, explicit)
+		}
+	}()
+
+	usr2Ch := make(chan os.Signal, 1)
+	notifyStatsDump(usr2Ch)
+	go func() {
+		for range usr2Ch {
+			srv.LogStats()
+		}
+	}()
+
+	if *logFile != "" {
+		usr1Ch := make(chan os.Signal, 1)
+		notifyLogReopen(usr1Ch)
+		go func() {
+			for range usr1Ch {
+				if err := eventlog.Reopen(); err != nil {
+					eventlog.Error("Log reopen", err)
+					continue
+				}
+				eventlog.Info("Reopened log file %s", *logFile)
+			}
+		}()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	// 全ポートで同じカウンタと MaxClients を共有する
+	var loops sync.WaitGroup
+	for _, ln := range listeners {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			var err error
+			if ov, ok := overrides[ln]; ok {
+				err = srv.ServeWith(ln, ov)
+			} else {
+				err = srv.Serve(ln)
+			}
+			if !errors.Is(err, orexis.ErrServerClosed) {
+				// 復帰できないエラーなので、このリスナーは諦める
+				eventlog.Error("Accept", err)
+			}
+		}()
+	}
+
+	// 全リスナーが落ちた場合も、接続を捌き切って終了する
+	loopsDone := make(chan struct{})
+	go func() {
+		loops.Wait()
+		close(loopsDone)
+	}()
+
+	select {
+	case sig := <-sigCh:
+		eventlog.Info("Received %v, shutting down", sig)
+	case <-loopsDone:
+	}
+
+	// 他のリスナーは Shutdown が閉じる
+	if controlLn != nil {
+		closeControl(controlLn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+	srv.Shutdown(ctx)
+}
+
+// listen opens the listeners Serve will be called on: the ones handed over
+// by socket activation if any, otherwise the Unix socket or TCP ports.
+func (o *options) listen() ([]net.Listener, error) {
+	activated, err := activationListeners()
+	if err != nil {
+		return nil, err
+	}
+	ver, _ := buildVersion()
+	if len(activated) > 0 {
+		for _, ln := range activated {
+			eventlog.Info("OREXIS listening on %s %s (socket activated) version=%s", ln.Addr().Network(), ln.Addr(), ver)
+		}
+		return activated, nil
+	}
+
+	if o.UnixSocket != "" {
+		ln, err := listenUnix(o.UnixSocket)
+		if err != nil {
+			return nil, err
+		}
+		eventlog.Info("OREXIS listening on unix %s version=%s", o.UnixSocket, ver)
+		return []net.Listener{ln}, nil
+	}
+
+	var controls []func(network, address string, c syscall.RawConn) error
+	if o.ReusePort || o.Acceptors > 1 {
+		controls = append(controls, reusePortControl)
+	}
+	if o.BindFamily == "tcp" {
+		// Go 自身も IPV6_V6ONLY を外すので、設定できない環境で困るのは -dualstack=false のときだけ
+		if v6OnlySupported {
+			controls = append(controls, v6OnlyControl(o.DualStack))
+		} else if !o.DualStack {
+			eventlog.Info("Warning: IPV6_V6ONLY cannot be set on this platform, -dualstack=false is ignored")
+		}
+	}
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		for _, control := range controls {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+	var listeners []net.Listener
+	for _, listenAddr := range o.listenAddrs() {
+		for range max(o.Acceptors, 1) {
+			ln, err := lc.Listen(context.Background(), o.BindFamily, listenAddr)
+			if err != nil {
+				closeAll(listeners)
+				return nil, err
+			}
+			if o.Backlog > 0 {
+				if err := setBacklog(ln, o.Backlog); err != nil {
+					eventlog.Info("Warning: backlog %d not applied on %s: %v", o.Backlog, listenAddr, err)
+				}
+			}
+			listeners = append(listeners, ln)
+		}
+		// 実際に受けるアドレスファミリーは OS とバインド先で変わるので、ソケットから読んで出す
+		families := listenFamilies(listeners[len(listeners)-1])
+		if o.Acceptors > 1 {
+			eventlog.Info("OREXIS listening on %s %s (%d acceptors) families=%s version=%s", o.BindFamily, listenAddr, o.Acceptors, families, ver)
+		} else {
+			eventlog.Info("OREXIS listening on %s %s families=%s version=%s", o.BindFamily, listenAddr, families, ver)
+		}
+	}
+	return listeners, nil
+}
+
+// warnLowDelay logs a warning if d is too short for the tarpit to hold
+// anyone, which is almost always a units mistake such as -d 10.
+func warnLowDelay(what string, d time.Duration) {
+	if d >= minEffectiveDelay {
+		return
+	}
+	eventlog.Info("Warning: %s is %v, below %v: clients are sent lines almost as fast as they read them, so the tarpit holds nobody and spends CPU and bandwidth (-d is in milliseconds)", what, d, minEffectiveDelay)
+}
+
+// closeAll closes the listeners opened so far when a later one fails.
+func closeAll(listeners []net.Listener) {
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
+
+// listenPorts returns the ports to bind when not socket activated.
+func (o *options) listenPorts() []int {
+	if len(o.Listeners) > 0 {
+		ports := make([]int, len(o.Listeners))
+		for i, ls := range o.Listeners {
+			ports[i] = ls.Port
+		}
+		return ports
+	}
+	if len(o.Ports) > 0 {
+		return o.Ports
+	}
+	return []int{o.Port}
+}
+
+// listenAddrs returns listenPorts combined with Bind. JoinHostPort puts
+// IPv6 literals in brackets, so Bind may be given with or without them.
+func (o *options) listenAddrs() []string {
+	host := strings.TrimSuffix(strings.TrimPrefix(o.Bind, "["), "]")
+	var addrs []string
+	for _, p := range o.listenPorts() {
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(p)))
+	}
+	return addrs
+}
+
+// listenUnix listens on a Unix socket at path, replacing a stale socket
+// left behind by a previous run. The listener unlinks the path on Close.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func dropPrivileges(userName, groupName string) error {
+	return errors.New("-user and -group are only supported on Unix")
+}
+
+func logDirWritable(path string) error {
+	return nil
+}
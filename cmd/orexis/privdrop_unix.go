@@ -0,0 +1,93 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/nexryai/orexis/internal/eventlog"
+	"golang.org/x/sys/unix"
+)
+
+// dropPrivileges switches the process to userName and groupName, given as
+// names or numeric ids. Without groupName the user's primary group is used.
+// It must run after every privileged listener is open and before any client
+// is served. The log file, if any, is handed to the new ids first.
+func dropPrivileges(userName, groupName string) error {
+	uid, gid := -1, -1
+	if userName != "" {
+		u, err := lookupUser(userName)
+		if err != nil {
+			return err
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+	if groupName != "" {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	// root で開いたログファイルを、落とした後も開き直せるようにする
+	if err := eventlog.Chown(uid, gid); err != nil {
+		return fmt.Errorf("chown log file: %w", err)
+	}
+
+	// グループは uid を変える前に変えないと権限が足りなくなる
+	if gid >= 0 {
+		// root の補助グループを引き継がないようにする
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return fmt.Errorf("setgroups: %w", err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("setgid %d: %w", gid, err)
+		}
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("setuid %d: %w", uid, err)
+		}
+		// 0 以外に落としたのに root に戻れてしまうなら落とせていない
+		if uid != 0 && syscall.Setuid(0) == nil {
+			return fmt.Errorf("setuid %d: still able to regain root", uid)
+		}
+	}
+
+	if (uid >= 0 && os.Getuid() != uid) || (gid >= 0 && os.Getgid() != gid) {
+		return fmt.Errorf("running as uid=%d gid=%d after dropping privileges", os.Getuid(), os.Getgid())
+	}
+	return nil
+}
+
+// logDirWritable reports whether the directory of the log file at path is
+// writable by the process as it runs now. Rotation renames and creates
+// files there.
+func logDirWritable(path string) error {
+	dir := filepath.Dir(path)
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		return fmt.Errorf("%s is not writable by uid %d: %w", dir, os.Getuid(), err)
+	}
+	return nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
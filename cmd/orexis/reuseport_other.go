@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || aix)
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows のほか、SO_REUSEPORT のない Solaris と illumos もここに来る
+const reusePortSupported = false
+
+var errReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errReusePortUnsupported
+}
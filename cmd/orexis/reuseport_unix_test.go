@@ -0,0 +1,60 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || aix
+
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nexryai/orexis"
+)
+
+// BenchmarkAccept measures accepted connections per second with one and
+// with several -acceptors listeners sharing a port.
+func BenchmarkAccept(b *testing.B) {
+	for _, acceptors := range []int{1, 4} {
+		b.Run("acceptors="+strconv.Itoa(acceptors), func(b *testing.B) {
+			c := orexis.DefaultConfig()
+			c.Delay = time.Hour
+			c.MaxClients = 1 << 20
+			c.LogSample = 0
+			srv, err := orexis.New(c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				srv.Shutdown(ctx)
+			}()
+
+			lc := net.ListenConfig{Control: reusePortControl}
+			addr := "127.0.0.1:0"
+			for range acceptors {
+				ln, err := lc.Listen(context.Background(), "tcp", addr)
+				if err != nil {
+					b.Fatal(err)
+				}
+				addr = ln.Addr().String()
+				go srv.Serve(ln)
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					// RST で閉じて、クライアント側に TIME_WAIT を残さない
+					conn.(*net.TCPConn).SetLinger(0)
+					conn.Close()
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "accepts/s")
+		})
+	}
+}
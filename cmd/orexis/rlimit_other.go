@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func fdLimit() (uint64, error) {
+	return 0, errors.New("file descriptor limits are not supported on this platform")
+}
+
+// 上限のない環境では引き上げるものもない
+func raiseFDLimit() (before, after uint64, err error) {
+	return 0, 0, nil
+}
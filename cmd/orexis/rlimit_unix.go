@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// fdLimit returns the soft RLIMIT_NOFILE of the process.
+func fdLimit() (uint64, error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	return uint64(lim.Cur), nil
+}
+
+// raiseFDLimit raises the soft RLIMIT_NOFILE to the hard limit and returns
+// the soft limit before and after. Go already does this at startup on
+// most systems, in which case both are the same.
+func raiseFDLimit() (before, after uint64, err error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, 0, err
+	}
+	before = uint64(lim.Cur)
+	if lim.Cur >= lim.Max {
+		return before, before, nil
+	}
+	lim.Cur = lim.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return before, before, err
+	}
+	return before, uint64(lim.Cur), nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// SIGUSR1 と SIGUSR2 のない環境では、どちらもシグナルでは受け付けない
+func notifyLogReopen(c chan<- os.Signal) {}
+func notifyStatsDump(c chan<- os.Signal) {}
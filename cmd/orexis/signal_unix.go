@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyLogReopen relays SIGUSR1, the signal logrotate sends after moving
+// the log file away, to c.
+func notifyLogReopen(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
+
+// notifyStatsDump relays SIGUSR2, which asks for a STATS line now, to c.
+func notifyStatsDump(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
@@ -0,0 +1,34 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+const v6OnlySupported = false
+
+var errSockoptUnsupported = errors.New("not supported on this platform")
+
+func listenPrivateUnix(path string) (net.Listener, error) {
+	return listenUnix(path)
+}
+
+func setBacklog(ln net.Listener, n int) error {
+	return errSockoptUnsupported
+}
+
+func v6OnlyControl(dualStack bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errSockoptUnsupported
+	}
+}
+
+func listenFamilies(ln net.Listener) string {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && addr.IP.To4() != nil {
+		return "ipv4"
+	}
+	return "unknown"
+}
@@ -0,0 +1,89 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const v6OnlySupported = true
+
+// listenPrivateUnix is listenUnix with the socket created under a umask of
+// 077, so that it is never reachable by other users, not even until a chmod.
+func listenPrivateUnix(path string) (net.Listener, error) {
+	// umask はプロセス全体の設定なので、ソケットを作る間だけ変える
+	old := syscall.Umask(0o077)
+	defer syscall.Umask(old)
+	return listenUnix(path)
+}
+
+// setBacklog calls listen(2) again on ln with a backlog of n. Go always
+// uses net.core.somaxconn; Linux and the BSDs let a second listen change
+// it on an already listening socket.
+func setBacklog(ln net.Listener, n int) error {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var lerr error
+	if err := rc.Control(func(fd uintptr) {
+		lerr = unix.Listen(int(fd), n)
+	}); err != nil {
+		return err
+	}
+	return lerr
+}
+
+// v6OnlyControl is a net.ListenConfig.Control that sets IPV6_V6ONLY on
+// IPv6 sockets to !dualStack, instead of leaving it to Go and the OS.
+func v6OnlyControl(dualStack bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if network != "tcp6" {
+			return nil
+		}
+		v6Only := 1
+		if dualStack {
+			v6Only = 0
+		}
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, v6Only)
+		}); err != nil {
+			return err
+		}
+		return serr
+	}
+}
+
+// listenFamilies reports which address families ln actually accepts:
+// "ipv4", "ipv6" or "ipv4+ipv6" for an IPv6 socket with IPV6_V6ONLY off.
+func listenFamilies(ln net.Listener) string {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && addr.IP.To4() != nil {
+		return "ipv4"
+	}
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return "unknown"
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return "unknown"
+	}
+	v6Only, serr := -1, error(nil)
+	if err := rc.Control(func(fd uintptr) {
+		v6Only, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_V6ONLY)
+	}); err != nil || serr != nil {
+		return "unknown"
+	}
+	if v6Only != 0 {
+		return "ipv6"
+	}
+	return "ipv4+ipv6"
+}
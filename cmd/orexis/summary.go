@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/nexryai/orexis"
+	"github.com/nexryai/orexis/internal/eventlog"
+)
+
+// logSummary logs one CONFIG line with the settings the process actually
+// runs with, after flags, the environment and the config file have been
+// merged.
+func (o *options) logSummary() {
+	f := eventlog.F
+	fields := []eventlog.Field{
+		f("listen", o.listenSummary()),
+		f("bind_family", o.BindFamily),
+		f("dualstack", o.DualStack && o.BindFamily == "tcp"),
+		f("delay", o.Delay),
+		f("first_delay", o.FirstDelay),
+		f("ramp", rampSummary(o.Ramp)),
+		f("jitter", o.Jitter),
+		f("line_length", fmt.Sprintf("%d-%d", o.MinLineLength, o.MaxLineLength)),
+		f("charset", o.Charset),
+		f("style", o.Style),
+		f("terminator", o.Terminator),
+		f("max_clients", o.MaxClients),
+		f("per_ip", o.PerIPLimit),
+		f("per_ip_rate", o.PerIPRate),
+		f("accept_rate", o.AcceptRate),
+		f("write_timeout", o.WriteTimeout),
+		f("max_lifetime", o.MaxLifetime),
+		f("max_bytes", o.MaxBytes),
+		f("max_bps", o.MaxBPS),
+		f("milestones", orexis.FormatMilestones(o.Milestones)),
+		f("allow", len(o.Allow)),
+		f("deny", len(o.Deny)),
+	}
+	if len(o.Listeners) > 0 {
+		fields = append(fields, f("listeners", len(o.Listeners)))
+	}
+	fields = append(fields, f("features", strings.Join(o.features(), ",")))
+	eventlog.Event("CONFIG:", fields...)
+}
+
+func (o *options) listenSummary() string {
+	if o.UnixSocket != "" {
+		return "unix:" + o.UnixSocket
+	}
+	ports := make([]string, 0, len(o.listenPorts()))
+	for _, p := range o.listenPorts() {
+		ports = append(ports, strconv.Itoa(p))
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(o.Bind, "["), "]")
+	return net.JoinHostPort(host, strings.Join(ports, ","))
+}
+
+func rampSummary(r orexis.Ramp) string {
+	switch {
+	case r.Start == 0:
+		return "off"
+	case r.Factor > 0:
+		return fmt.Sprintf("exp:%v:%g", r.Start, r.Factor)
+	default:
+		return fmt.Sprintf("linear:%v:%v", r.Start, r.Step)
+	}
+}
+
+// features lists the optional behaviours that are switched on, or "none".
+func (o *options) features() []string {
+	var on []string
+	add := func(enabled bool, name string) {
+		if enabled {
+			on = append(on, name)
+		}
+	}
+	add(o.Poll, "poll")
+	add(o.TLS != nil, "tls")
+	add(o.ProxyProtocol, "proxy-protocol")
+	add(o.Peek > 0, "peek")
+	add(o.WaitForClient, "wait-for-client")
+	add(o.SSHBanner != "", "ssh-banner")
+	add(len(o.Banner) > 0, "banner")
+	add(o.BannerPipe != nil, "banner-pipe")
+	add(o.ResetOnClose, "rst-on-close")
+	add(o.Dribble, "dribble")
+	add(o.Chaos, "chaos")
+	add(o.ExcludeBytes != "", "exclude-bytes")
+	add(o.Seed != 0, "seed")
+	add(o.CloseRead, "close-read")
+	add(o.PauseAtMax, "pause-at-max")
+	add(o.KeepAlive > 0, "keepalive")
+	add(o.Nagle, "nagle")
+	add(o.KnockPort != 0, "knock")
+	add(o.ReusePort || o.Acceptors > 1, "reuseport")
+	add(o.ConnRecords, "conn-records")
+	add(o.LogSample < 1, "log-sample")
+	add(o.TopIPs > 0, "top-ips")
+	add(o.RollingPeak, "rolling-peak")
+	add(o.StateFile != "", "state-file")
+	add(o.GeoIPPath != "", "geoip")
+	add(o.Resolve, "resolve")
+	add(o.StatsdAddr != "", "statsd")
+	add(o.MetricsAddr != "", "metrics")
+	add(o.HealthAddr != "", "health")
+	add(o.PprofAddr != "", "pprof")
+	add(o.Control != "", "control")
+	add(o.OnAcceptExec != "", "on-accept-exec")
+	add(o.WebhookURL != "", "webhook")
+	if len(on) == 0 {
+		return []string{"none"}
+	}
+	return on
+}
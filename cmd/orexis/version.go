@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// リリースビルドでは -ldflags "-X main.version=v1.2.3 -X main.commit=abcdef0" で埋め込む
+var (
+	version string
+	commit  string
+)
+
+// buildVersion returns the version and commit set with -ldflags, falling
+// back to what the Go toolchain recorded in the binary.
+func buildVersion() (ver, rev string) {
+	ver, rev = version, commit
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return cmp.Or(ver, "unknown"), cmp.Or(rev, "unknown")
+	}
+	if ver == "" {
+		ver = info.Main.Version
+	}
+	if rev == "" {
+		var modified bool
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rev = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if rev != "" && modified {
+			rev += "-dirty"
+		}
+	}
+	return cmp.Or(ver, "unknown"), cmp.Or(rev, "unknown")
+}
+
+// versionLine is what -version prints.
+func versionLine() string {
+	ver, rev := buildVersion()
+	return fmt.Sprintf("orexis %s (commit %s, %s)", ver, rev, runtime.Version())
+}
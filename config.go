@@ -0,0 +1,222 @@
+package orexis
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultDelay         = 10 * time.Second
+	DefaultMinLineLength = 3
+	DefaultMaxLineLength = 32
+	// 1行の長さの上限。RFC 4253 のバージョン行と同じ 255 バイト
+	MaxLineLengthLimit  = 255
+	DefaultMaxClients   = 4096
+	DefaultWriteTimeout = 30 * time.Second
+	// PROXY ヘッダを送ってこない接続でゴルーチンが止まらないようにするための期限
+	DefaultHandshakeTimeout = 5 * time.Second
+	DefaultStatsInterval    = 1 * time.Minute
+	DefaultKnockTTL         = 5 * time.Minute
+)
+
+// Config controls how a Server treats the clients it traps. Unless noted
+// otherwise a field can be changed on a running server with Reload; the
+// ones marked "New only" are read once when the server is created.
+type Config struct {
+	Delay time.Duration
+	// 接続直後は短い間隔から始め、書き込むたびに Delay まで伸ばす (ゼロ値で無効)
+	Ramp Ramp
+	// 最初の1行を送るまでの待ち時間。すぐ応答して相手を引き込み、その後で Delay に切り替える
+	FirstDelay time.Duration
+	// ランダムな行の長さの範囲 (終端を含む)。同じ値にすると固定長になる
+	MinLineLength int
+	MaxLineLength int
+	MaxClients    int64
+	// MaxClients に達したら受け付けて閉じる代わりに Accept を止め、カーネルのバックログに待たせる
+	PauseAtMax bool
+	// 1秒あたりに受け付ける新規接続数の上限 (0 で無制限、New only)
+	AcceptRate float64
+	// 同一IPからの同時接続数の上限 (0 で無制限)
+	PerIPLimit int
+	// 同一IPから1秒あたりに受け付ける新規接続数の上限 (0 で無制限)。再接続を繰り返す相手を抑える
+	PerIPRate float64
+	// 接続直後に PROXY protocol v1 ヘッダを読み、実際の接続元を使う
+	ProxyProtocol bool
+	// nil でなければ PROXY ヘッダの後に TLS のハンドシェイクをし、暗号化した上で同じように行を送る
+	TLS *tls.Config
+	// PROXY ヘッダ、TLS のハンドシェイク、Peek と WaitForClient にかけられる時間の合計 (0 で無制限)
+	HandshakeTimeout time.Duration
+	// 0 より大きければ、書き始める前にこの時間だけ相手が先に送ってくるか待ち、CLIENTDATA と CLIENTBANNER を出す
+	Peek time.Duration
+	// 相手が最初の1行 (SSH のバージョン文字列) を送ってくるまで黙って待ち、CLIENTBANNER を出してから書き始める。
+	// HandshakeTimeout までに送ってこない相手は切断する。Peek より優先される
+	WaitForClient bool
+	// 0 以外なら乱数をこの値で初期化し、出力を再現できるようにする
+	Seed int64
+	// ランダムな行に使う文字の種類 (CharsetASCII など)
+	Charset string
+	// ランダムな行の見た目 (StyleRandom など)。StyleWordlike では Charset によらず英小文字と空白だけになる
+	Style string
+	// ランダムな行に使わないバイト (引用符やバックスラッシュなど)。Chaos で混ぜるシーケンスには効かない
+	ExcludeBytes string
+	// 行の終端 (TerminatorCRLF など)。SSHBanner だけは常に CRLF で送る
+	Terminator string
+	// ランダムな行にときどき ANSI エスケープシーケンスを混ぜ、端末で見ているスキャナーの画面を乱す
+	Chaos bool
+	// 受け付けた接続の SO_RCVBUF (0 で OS の既定値のまま)
+	ReadBuffer int
+	// 受け付けた直後に受信側を閉じ、相手が送ってくるデータをカーネルに捨てさせる
+	CloseRead bool
+	// 1行ずつではなく1バイトずつ、間に Delay を挟んで送る
+	Dribble bool
+	// Delay をこの割合 (%) だけ上下にランダムにずらす
+	Jitter int
+	// 0 より大きければ受け付けた TCP 接続でこの間隔の keepalive を有効にする (0 ならリスナーの既定のまま)
+	KeepAlive time.Duration
+	// TCP_NODELAY を外して Nagle を有効にする。Go の既定は NODELAY で、Dribble の1バイトもすぐ出る
+	Nagle bool
+	// Shutdown の猶予切れと Kick で閉じる TCP 接続に、FIN ではなく RST を送る (SO_LINGER 0)。
+	// 正常に閉じたのではなく落ちたように見せる
+	ResetOnClose bool
+	// 1行の書き込みにかけられる時間。FIN なしで消えた相手を刈り取るため (0 で無効)
+	WriteTimeout time.Duration
+	// 接続を保持する最大時間 (0 で無制限)
+	MaxLifetime time.Duration
+	// 1接続に送る最大バイト数。達したら切断する (0 で無制限)
+	MaxBytes int64
+	// 全接続を合わせた送信レートの上限 (バイト/秒)。超えそうなら書き込みを待たせる (0 で無制限、New only)
+	MaxBPS int64
+	// タールピットせずにすぐ閉じる送信元 (監視など)
+	Allow IPList
+	// 1行も送らずに切断する送信元。Allow より先に評価されるので、両方に該当すれば DROP になる
+	Deny IPList
+	// ServeKnock のポートに接続した送信元を、この時間だけ Allow と同じように扱う (0 で記録しない)
+	KnockTTL time.Duration
+	// 空でなければ最初の1行としてそのまま送る SSH のバージョン文字列
+	SSHBanner string
+	// 空でなければランダムな行の代わりにこの行を順番に送る
+	Banner []string
+	// nil でなければ接続ごとにこれで作った生成器の行を、Banner やランダムな行の代わりに送る
+	LineGenerator func() LineGenerator
+	// Linux では goroutine の代わりに epoll のイベントループで接続を扱う (New only)
+	Poll bool
+	// STATS を出す間隔 (0 で定期出力なし。停止時の1行だけは出る、New only)
+	StatsInterval time.Duration
+	// 空でなければ TotalConnects と TotalBytesSent を STATS のたびと停止時にこのファイルへ保存し、
+	// 起動時に読み込んで続きから数える (読み込みは New only)
+	StateFile string
+	// 1つの接続を捕まえ続けた時間がそれぞれを超えたときに MILESTONE を出す (増加順)
+	Milestones []time.Duration
+	// ACCEPT と DISCONNECT の代わりに、切断時に接続ごとの CONNECTION を1行だけ出す
+	ConnRecords bool
+	// 接続のうちこの割合 (0-1) だけ ACCEPT と DISCONNECT を出す。STATS とメトリクスは全接続を数える
+	LogSample float64
+	// 0 より大きければ、STATS のたびに接続回数の多い送信元をこの数だけ TOPIPS に出す
+	// (数え始めるかどうかは New only)
+	TopIPs int
+	// STATS を出すたびに PeakClients をリセットする
+	RollingPeak bool
+	// MaxMind GeoLite2-Country データベース。指定すると ACCEPT に country を付ける (New only)
+	GeoIPPath string
+	// 空でなければ接続数と送信バイト数をこの statsd サーバーに UDP で送る (New only)
+	StatsdAddr string
+	// 送信元の逆引き結果を ptr として ACCEPT と DISCONNECT に付ける。引くのは裏で行う (New only)
+	Resolve bool
+	// 受け付けるたびに実行するコマンドと POST 先の URL (New only)
+	OnAcceptExec string
+	WebhookURL   string
+}
+
+// DefaultConfig returns the settings the orexis command uses when no flags
+// are given.
+func DefaultConfig() Config {
+	c := Config{
+		Delay:            DefaultDelay,
+		MinLineLength:    DefaultMinLineLength,
+		MaxLineLength:    DefaultMaxLineLength,
+		MaxClients:       DefaultMaxClients,
+		Charset:          CharsetASCII,
+		Style:            StyleRandom,
+		Terminator:       TerminatorCRLF,
+		ReadBuffer:       1,
+		WriteTimeout:     DefaultWriteTimeout,
+		HandshakeTimeout: DefaultHandshakeTimeout,
+		StatsInterval:    DefaultStatsInterval,
+		LogSample:        1,
+		KnockTTL:         DefaultKnockTTL,
+	}
+	c.Milestones, _ = ParseMilestones(DefaultMilestones)
+	return c
+}
+
+// validate checks the merged configuration, whichever layer each value came
+// from, so that a typo'd flag fails at startup instead of panicking later.
+func (c *Config) validate() error {
+	if c.MaxLineLength < 3 || c.MaxLineLength > MaxLineLengthLimit {
+		return fmt.Errorf("max line length %d is outside 3-255", c.MaxLineLength)
+	}
+	if c.MinLineLength < 3 || c.MinLineLength > c.MaxLineLength {
+		return fmt.Errorf("min line length %d is outside 3-%d (the max line length)", c.MinLineLength, c.MaxLineLength)
+	}
+	if c.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if err := c.Ramp.validate(); err != nil {
+		return err
+	}
+	if c.FirstDelay < 0 {
+		return fmt.Errorf("first delay must not be negative")
+	}
+	if c.MaxClients < 1 {
+		return fmt.Errorf("max clients must be at least 1")
+	}
+	if err := validateCharset(c.Charset); err != nil {
+		return err
+	}
+	if err := validateStyle(c.Style); err != nil {
+		return err
+	}
+	if err := validateExcludeBytes(c.Charset, c.ExcludeBytes); err != nil {
+		return err
+	}
+	if err := validateTerminator(c.Terminator); err != nil {
+		return err
+	}
+	if c.ReadBuffer < 0 {
+		return fmt.Errorf("read buffer %d must not be negative", c.ReadBuffer)
+	}
+	if c.PerIPRate < 0 {
+		return fmt.Errorf("per ip rate %v must not be negative", c.PerIPRate)
+	}
+	if c.HandshakeTimeout < 0 {
+		return fmt.Errorf("handshake timeout must not be negative")
+	}
+	if c.KnockTTL < 0 {
+		return fmt.Errorf("knock ttl must not be negative")
+	}
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("max bytes %d must not be negative", c.MaxBytes)
+	}
+	if c.MaxBPS < 0 {
+		return fmt.Errorf("max bps %d must not be negative", c.MaxBPS)
+	}
+	if err := validateMilestones(c.Milestones); err != nil {
+		return err
+	}
+	if c.LogSample < 0 || c.LogSample > 1 {
+		return fmt.Errorf("log sample %v is outside 0-1", c.LogSample)
+	}
+	if c.TopIPs < 0 {
+		return fmt.Errorf("top ips %d must not be negative", c.TopIPs)
+	}
+	if c.Jitter < 0 || c.Jitter > 100 {
+		return fmt.Errorf("jitter %d is outside 0-100", c.Jitter)
+	}
+	if c.SSHBanner != "" {
+		if err := validateSSHBanner(c.SSHBanner); err != nil {
+			return fmt.Errorf("ssh banner: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package orexis
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidateMaxLineLengthBoundaries(t *testing.T) {
+	for _, maxLen := range []int{3, 4, MaxLineLengthLimit} {
+		c := DefaultConfig()
+		c.MaxLineLength = maxLen
+		if err := c.validate(); err != nil {
+			t.Fatalf("max line length %d: %v", maxLen, err)
+		}
+
+		var conf atomic.Pointer[Config]
+		conf.Store(&c)
+		gen := newLineGenerator(&conf, NewSeededRand(1))
+		buf := make([]byte, MaxLineLengthLimit)
+		for i := 0; i < 1000; i++ {
+			if n := gen.Next(buf); n < c.MinLineLength || n > maxLen {
+				t.Fatalf("max line length %d: line of %d bytes", maxLen, n)
+			}
+		}
+	}
+
+	for _, maxLen := range []int{2, MaxLineLengthLimit + 1} {
+		c := DefaultConfig()
+		c.MaxLineLength = maxLen
+		if err := c.validate(); err == nil {
+			t.Fatalf("max line length %d was accepted", maxLen)
+		}
+	}
+}
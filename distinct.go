@@ -0,0 +1,82 @@
+package orexis
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// 2^14 個のレジスタで誤差はおよそ 0.8%、1つあたり 16KiB
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct strings added to it in a
+// fixed amount of memory.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	// 残りのビットが全部 0 でも rank が範囲を超えないよう番兵を立てる
+	w := hash<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(bits.LeadingZeros64(w) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	const m = float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// 少ないうちは linear counting の方が正確で、ほぼ正確な値になる
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
+
+func (h *hyperLogLog) reset() {
+	clear(h.registers[:])
+}
+
+// distinctIPs counts the distinct source addresses seen since start and
+// since the last STATS line.
+type distinctIPs struct {
+	seed     maphash.Seed
+	mu       sync.Mutex
+	interval hyperLogLog
+	lifetime hyperLogLog
+}
+
+func newDistinctIPs() *distinctIPs {
+	return &distinctIPs{seed: maphash.MakeSeed()}
+}
+
+func (d *distinctIPs) add(host string) {
+	hash := maphash.String(d.seed, host)
+	d.mu.Lock()
+	d.interval.add(hash)
+	d.lifetime.add(hash)
+	d.mu.Unlock()
+}
+
+// counts returns the interval and lifetime estimates, starting a new
+// interval if reset is set.
+func (d *distinctIPs) counts(reset bool) (interval, lifetime int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	interval, lifetime = d.interval.estimate(), d.lifetime.estimate()
+	if reset {
+		d.interval.reset()
+	}
+	return interval, lifetime
+}
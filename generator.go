@@ -0,0 +1,93 @@
+package orexis
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// LineGenerator produces the lines sent to one client after the optional
+// SSHBanner. Next writes the next line, terminator included, into buf,
+// which holds MaxLineLengthLimit bytes, and returns its length, which must
+// be at least 1. Each line is written as one chunk (one byte at a time with
+// Dribble), so a custom generator is responsible for not starting a line
+// with "SSH-".
+type LineGenerator interface {
+	Next(buf []byte) int
+}
+
+// randomLines is the built-in generator of random lines.
+type randomLines struct {
+	rng            *rand.Rand
+	minLen, maxLen int
+	alphabet       *alphabet
+	term           string
+	chaos          bool
+}
+
+func (g *randomLines) Next(buf []byte) int {
+	n := generateLineInto(buf, g.rng, g.minLen, g.maxLen, g.alphabet, g.term)
+	if g.chaos {
+		injectChaos(g.rng, buf[:n-len(g.term)], g.alphabet.charset)
+	}
+	return n
+}
+
+// bannerLines repeats Config.Banner. pos points at the client's
+// configLines.bannerPos, so a reload that keeps the banner keeps the position.
+type bannerLines struct {
+	lines  []string
+	pos    *int
+	maxLen int
+	term   string
+}
+
+func (g *bannerLines) Next(buf []byte) int {
+	line := g.lines[*g.pos%len(g.lines)]
+	*g.pos++
+	return formatBannerLineInto(buf, line, g.maxLen, g.term)
+}
+
+// configLines is the generator of a client without Config.LineGenerator.
+// It picks the built-in generator for the client's current configuration
+// and picks again only when Reload has replaced it.
+type configLines struct {
+	conf      *atomic.Pointer[Config]
+	rng       *rand.Rand
+	bannerPos int
+
+	config *Config
+	gen    LineGenerator
+}
+
+func (g *configLines) Next(buf []byte) int {
+	if c := g.conf.Load(); c != g.config {
+		g.config = c
+		g.gen = g.builtin(c)
+	}
+	return g.gen.Next(buf)
+}
+
+func (g *configLines) builtin(c *Config) LineGenerator {
+	term := terminatorBytes(c.Terminator)
+	if len(c.Banner) > 0 {
+		return &bannerLines{lines: c.Banner, pos: &g.bannerPos, maxLen: c.MaxLineLength, term: term}
+	}
+	return &randomLines{
+		rng:      g.rng,
+		minLen:   c.MinLineLength,
+		maxLen:   c.MaxLineLength,
+		alphabet: alphabetFor(c.Charset, c.Style, c.ExcludeBytes),
+		term:     term,
+		chaos:    c.Chaos,
+	}
+}
+
+// newLineGenerator returns the generator for a client accepted with conf.
+// A Config.LineGenerator is asked once, when the client arrives, and keeps
+// serving it across reloads.
+func newLineGenerator(conf *atomic.Pointer[Config], rng *rand.Rand) LineGenerator {
+	if newGen := conf.Load().LineGenerator; newGen != nil {
+		return newGen()
+	}
+	return &configLines{conf: conf, rng: rng}
+}
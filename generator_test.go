@@ -0,0 +1,72 @@
+package orexis
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRandomLines(t *testing.T) {
+	g := &randomLines{
+		rng:      NewSeededRand(1),
+		minLen:   10,
+		maxLen:   20,
+		alphabet: alphabetFor(CharsetASCII, StyleRandom, ""),
+		term:     "\n",
+	}
+	buf := make([]byte, MaxLineLengthLimit)
+	for i := 0; i < 1000; i++ {
+		n := g.Next(buf)
+		if n < 10 || n > 20 || buf[n-1] != '\n' {
+			t.Fatalf("line %q is not 10-20 bytes ending in LF", buf[:n])
+		}
+	}
+}
+
+func TestBannerLines(t *testing.T) {
+	var pos int
+	g := &bannerLines{lines: []string{"first", "a longer second line"}, pos: &pos, maxLen: 10, term: "\r\n"}
+	buf := make([]byte, MaxLineLengthLimit)
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, string(buf[:g.Next(buf)]))
+	}
+
+	// 長すぎる行は終端込みで maxLen に切り詰め、最後まで送ったら先頭に戻る
+	want := []string{"first\r\n", "a longer\r\n", "first\r\n", "a longer\r\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if pos != 4 {
+		t.Fatalf("pos is %d after 4 lines, want 4", pos)
+	}
+}
+
+func TestConfigLinesReload(t *testing.T) {
+	c := DefaultConfig()
+	var conf atomic.Pointer[Config]
+	conf.Store(&c)
+	g := &configLines{conf: &conf, rng: NewSeededRand(1)}
+	buf := make([]byte, MaxLineLengthLimit)
+
+	g.Next(buf)
+	if _, ok := g.gen.(*randomLines); !ok {
+		t.Fatalf("generator without a banner is %T, want *randomLines", g.gen)
+	}
+	first := g.gen
+	g.Next(buf)
+	if g.gen != first {
+		t.Fatal("generator was replaced without a reload")
+	}
+
+	// Reload と同じく設定を差し替えると、次の行からバナーになる
+	next := c
+	next.Banner = []string{"hello"}
+	conf.Store(&next)
+	if line := string(buf[:g.Next(buf)]); line != "hello\r\n" {
+		t.Fatalf("first line after reload is %q, want %q", line, "hello\r\n")
+	}
+	if _, ok := g.gen.(*bannerLines); !ok {
+		t.Fatalf("generator with a banner is %T, want *bannerLines", g.gen)
+	}
+}
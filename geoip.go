@@ -0,0 +1,17 @@
+package orexis
+
+import "net"
+
+// countryOf returns the ISO country code for host, or "??" when it cannot
+// be determined (private ranges, addresses missing from the database).
+func (s *Server) countryOf(host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "??"
+	}
+	record, err := s.geoDB.Country(ip)
+	if err != nil || record.Country.IsoCode == "" {
+		return "??"
+	}
+	return record.Country.IsoCode
+}
@@ -1,3 +1,13 @@
 module github.com/nexryai/orexis
 
 go 1.25.4
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/oschwald/geoip2-golang v1.13.0
+	golang.org/x/sys v0.47.0
+	golang.org/x/time v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/oschwald/maxminddb-golang v1.13.0 // indirect
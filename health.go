@@ -0,0 +1,24 @@
+package orexis
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HealthHandler serves /healthz, which is OK whenever the process is up, and
+// /readyz, which is OK only while the server is accepting clients.
+func (s *Server) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "OK clients=%d\n", s.currentClients.Load())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "NOT READY clients=%d\n", s.currentClients.Load())
+			return
+		}
+		fmt.Fprintf(w, "READY clients=%d\n", s.currentClients.Load())
+	})
+	return mux
+}
@@ -0,0 +1,139 @@
+package orexis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hookWorkers   = 4
+	hookQueueSize = 256
+	hookTimeout   = 10 * time.Second
+	// キューが溢れたときの警告はこの間隔に1回だけ出す
+	hookDropWarnInterval = 10 * time.Second
+)
+
+// hookEvent is what is passed to Config.OnAcceptExec and Config.WebhookURL.
+type hookEvent struct {
+	Event     string    `json:"event"`
+	Host      string    `json:"host"`
+	Port      string    `json:"port"`
+	LocalPort string    `json:"local_port"`
+	Time      time.Time `json:"ts"`
+}
+
+// hookRunner delivers events to the configured hooks from a fixed pool of
+// workers, so a slow hook can never stall the accept path.
+type hookRunner struct {
+	queue   chan hookEvent
+	command []string
+	webhook string
+	client  *http.Client
+
+	mu       sync.Mutex
+	lastWarn time.Time
+	dropped  int
+}
+
+// startHooks validates the hook settings and starts the workers. command is
+// split on whitespace and run without a shell; "{ip}" in any argument is
+// replaced with the client address.
+func startHooks(command, webhook string) (*hookRunner, error) {
+	h := &hookRunner{
+		queue:   make(chan hookEvent, hookQueueSize),
+		command: strings.Fields(command),
+		webhook: webhook,
+		client:  &http.Client{Timeout: hookTimeout},
+	}
+
+	if webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q", webhook)
+		}
+	}
+	if command != "" && len(h.command) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	for i := 0; i < hookWorkers; i++ {
+		go h.worker()
+	}
+	return h, nil
+}
+
+// fire queues ev without blocking, dropping it if the workers are behind.
+func (h *hookRunner) fire(ev hookEvent) {
+	select {
+	case h.queue <- ev:
+		return
+	default:
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dropped++
+	if now := time.Now(); now.Sub(h.lastWarn) >= hookDropWarnInterval {
+		logInfo("Warning: hook queue full, dropped %d events", h.dropped)
+		h.lastWarn = now
+		h.dropped = 0
+	}
+}
+
+func (h *hookRunner) worker() {
+	for ev := range h.queue {
+		if len(h.command) > 0 {
+			if err := h.runCommand(ev); err != nil {
+				logError("Hook exec", fmt.Errorf("host=%s: %w", ev.Host, err))
+			}
+		}
+		if h.webhook != "" {
+			if err := h.postWebhook(ev); err != nil {
+				logError("Webhook", fmt.Errorf("host=%s: %w", ev.Host, err))
+			}
+		}
+	}
+}
+
+func (h *hookRunner) runCommand(ev hookEvent) error {
+	args := make([]string, len(h.command))
+	for i, arg := range h.command {
+		args[i] = strings.ReplaceAll(arg, "{ip}", ev.Host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return err
+}
+
+func (h *hookRunner) postWebhook(ev hookEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(h.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
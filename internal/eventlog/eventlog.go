@@ -0,0 +1,168 @@
+// Package eventlog writes the "LABEL key=value" log lines shared by the
+// tarpit and its command, or their JSON equivalent.
+package eventlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var jsonLogs bool
+
+// ログの出力先。SetFile で切り替えるまでは標準出力
+var output io.Writer = os.Stdout
+
+// Field is one key/value pair attached to a log event. Keys are written
+// as-is in text mode and converted to snake_case in JSON mode.
+type Field struct {
+	key   string
+	value any
+}
+
+// Quoted is a field value written in double quotes with Go escapes in text
+// mode, for strings that may contain spaces, and as a plain string in JSON.
+type Quoted string
+
+func (q Quoted) String() string {
+	return strconv.Quote(string(q))
+}
+
+// F is shorthand for a Field.
+func F(key string, value any) Field {
+	return Field{key: key, value: value}
+}
+
+// Setup configures the standard logger for the given format.
+func Setup(format string) error {
+	log.SetOutput(output)
+
+	switch format {
+	case FormatText:
+		jsonLogs = false
+		log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC)
+	case FormatJSON:
+		// タイムスタンプは JSON の ts フィールドに入れる
+		jsonLogs = true
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("unknown log format %q (want %s or %s)", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+// Event logs a named event. label is the text-mode prefix such as
+// "ACCEPT" or "STATS:"; the JSON event name is derived from it.
+func Event(label string, fields ...Field) {
+	if jsonLogs {
+		event := strings.ToLower(strings.TrimSuffix(label, ":"))
+		log.Print(encodeJSON(event, fields))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(label)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.key, f.value)
+	}
+	log.Print(b.String())
+}
+
+// Error logs a failed operation, e.g. Error("Accept", err).
+func Error(op string, err error) {
+	if jsonLogs {
+		log.Print(encodeJSON("error", []Field{F("op", op), F("error", err.Error())}))
+		return
+	}
+	log.Printf("%s error: %v", op, err)
+}
+
+// Info logs a free-form message.
+func Info(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonLogs {
+		log.Print(encodeJSON("info", []Field{F("msg", msg)}))
+		return
+	}
+	log.Print(msg)
+}
+
+// Fatal logs a message and exits.
+func Fatal(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonLogs {
+		log.Fatal(encodeJSON("fatal", []Field{F("msg", msg)}))
+	}
+	log.Fatalf("Fatal: %s", msg)
+}
+
+func encodeJSON(event string, fields []Field) string {
+	var b bytes.Buffer
+	b.WriteString(`{"event":`)
+	writeJSONValue(&b, event)
+	b.WriteString(`,"ts":`)
+	writeJSONValue(&b, time.Now().UTC().Format(time.RFC3339Nano))
+	for _, f := range fields {
+		b.WriteByte(',')
+		writeJSONValue(&b, snakeCase(f.key))
+		b.WriteByte(':')
+		writeJSONValue(&b, f.value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func writeJSONValue(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case Quoted:
+		v2, _ := json.Marshal(string(v))
+		b.Write(v2)
+		return
+	case time.Duration:
+		// 秒単位の数値にしておくと集計しやすい
+		v2, _ := json.Marshal(v.Seconds())
+		b.Write(v2)
+		return
+	case error:
+		v2, _ := json.Marshal(v.Error())
+		b.Write(v2)
+		return
+	case fmt.Stringer:
+		v2, _ := json.Marshal(v.String())
+		b.Write(v2)
+		return
+	}
+
+	enc, err := json.Marshal(v)
+	if err != nil {
+		enc, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(enc)
+}
+
+// snakeCase converts "CurrentClients" to "current_clients".
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
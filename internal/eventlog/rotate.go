@@ -0,0 +1,122 @@
+package eventlog
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an append-only log file that is renamed to path.1 (and
+// older backups shifted to path.2, ...) once it would grow past maxSize.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// SetFile sends log lines to the file at path instead of stdout. Once the
+// file would exceed maxSize bytes it is rotated, keeping maxBackups old
+// files; a maxSize of 0 never rotates.
+func SetFile(path string, maxSize int64, maxBackups int) error {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return err
+	}
+	output = r
+	log.SetOutput(r)
+	return nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			// 回せなくても今のファイルに書き続け、ログ自体は失わない
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	// 一番古いものから順に1つずつずらし、上限を超えた分は上書きで消える
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+
+	r.f.Close()
+	r.f = nil
+	var err error
+	if r.maxBackups > 0 {
+		err = os.Rename(r.path, r.path+".1")
+	} else {
+		err = os.Remove(r.path)
+	}
+	if oerr := r.open(); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+// Chown hands the file set with SetFile to uid and gid, before dropping
+// root, so that Reopen and rotation can still open it afterwards. -1
+// leaves that id unchanged. Without a log file it does nothing.
+func Chown(uid, gid int) error {
+	r, ok := output.(*rotatingFile)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Chown(uid, gid)
+}
+
+// Reopen closes and reopens the file set with SetFile, for external tools
+// such as logrotate that rename it away and signal the process. Without a
+// log file it does nothing.
+func Reopen() error {
+	r, ok := output.(*rotatingFile)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.f
+	// 開き直せなければ、リネームされた古いファイルに書き続ける
+	if err := r.open(); err != nil {
+		r.f = old
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package orexis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ipRateLimiter keeps a token bucket per source IP for Config.PerIPRate.
+// Buckets are kept in least-recently-used order so that idle ones can be
+// dropped cheaply and at most maxTrackedIPs are held.
+type ipRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// 先頭ほど最近使われたバケット
+	lru *list.List
+}
+
+type ipBucket struct {
+	host   string
+	tokens float64
+	last   time.Time
+}
+
+func newIPRateLimiter() *ipRateLimiter {
+	return &ipRateLimiter{buckets: make(map[string]*list.Element), lru: list.New()}
+}
+
+// allow takes a token from host's bucket, which refills at perSec and
+// holds up to one second's worth (at least one connection).
+func (l *ipRateLimiter) allow(host string, perSec float64) bool {
+	burst := max(1, perSec)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictIdle(now, burst/perSec)
+
+	var b *ipBucket
+	if e, ok := l.buckets[host]; ok {
+		l.lru.MoveToFront(e)
+		b = e.Value.(*ipBucket)
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*perSec)
+	} else {
+		if l.lru.Len() >= maxTrackedIPs {
+			l.remove(l.lru.Back())
+		}
+		b = &ipBucket{host: host, tokens: burst}
+		l.buckets[host] = l.lru.PushFront(b)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// evictIdle drops buckets unused for refill, the time after which they are
+// full again and so no different from a new one.
+func (l *ipRateLimiter) evictIdle(now time.Time, refill float64) {
+	for e := l.lru.Back(); e != nil; e = l.lru.Back() {
+		if now.Sub(e.Value.(*ipBucket).last).Seconds() < refill {
+			return
+		}
+		l.remove(e)
+	}
+}
+
+func (l *ipRateLimiter) remove(e *list.Element) {
+	l.lru.Remove(e)
+	delete(l.buckets, e.Value.(*ipBucket).host)
+}
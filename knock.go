@@ -0,0 +1,102 @@
+package orexis
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// knockList remembers the addresses that connected to a knock listener and
+// until when they bypass the tarpit.
+type knockList struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newKnockList() *knockList {
+	return &knockList{until: make(map[string]time.Time)}
+}
+
+// add lets host bypass the tarpit for ttl. It reports false if the list is
+// full of unexpired entries, so that a scan of the knock port cannot grow
+// it without bound.
+func (k *knockList) add(host string, ttl time.Duration) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := k.until[host]; !ok && len(k.until) >= maxTrackedIPs {
+		for h, t := range k.until {
+			if !now.Before(t) {
+				delete(k.until, h)
+			}
+		}
+		if len(k.until) >= maxTrackedIPs {
+			return false
+		}
+	}
+	k.until[host] = now.Add(ttl)
+	return true
+}
+
+func (k *knockList) contains(host string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	t, ok := k.until[host]
+	if ok && !time.Now().Before(t) {
+		delete(k.until, host)
+		return false
+	}
+	return ok
+}
+
+// ServeKnock accepts connections on a secret knock port. Each one is
+// closed at once, and its source address then bypasses the tarpit on every
+// other listener, like an Allow entry, for Config.KnockTTL. Knocks are kept
+// in memory only. After Shutdown it returns ErrServerClosed.
+func (s *Server) ServeKnock(listener net.Listener) error {
+	defer listener.Close()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, listener)
+		s.mu.Unlock()
+	}()
+
+	var backoff acceptBackoff
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			if isTransientAcceptError(err) {
+				backoff.wait(err)
+				continue
+			}
+			return err
+		}
+		backoff.reset()
+
+		host, _ := splitAddr(conn.RemoteAddr())
+		conn.Close()
+		ttl := s.config.Load().KnockTTL
+		if host == "" || ttl <= 0 {
+			continue
+		}
+		if s.knocks.add(host, ttl) {
+			logEvent("KNOCK", kv("host", host), kv("ttl", ttl))
+		} else {
+			logEvent("KNOCK", kv("host", host), kv("reason", "full"))
+		}
+	}
+}
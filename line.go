@@ -0,0 +1,109 @@
+package orexis
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// connRands counts the RNGs made by newConnRand in this process.
+var connRands atomic.Uint64
+
+// newConnRand returns the RNG for one connection. With a non-zero seed every
+// connection replays the same sequence (see Config.Seed); otherwise its PCG
+// state comes from crypto/rand, so clients accepted at the same instant
+// still get independent banner streams.
+func newConnRand(seed int64) *rand.Rand {
+	if seed != 0 {
+		return NewSeededRand(seed)
+	}
+
+	// 行は暗号強度を必要としないので、ChaCha8 より速い PCG を使う。crypto/rand.Read は失敗しない
+	var buf [16]byte
+	crand.Read(buf[:])
+	// crypto/rand はカーネルから読むので通常はこれで十分だが、プロセスが複製されたり同じ乱数が
+	// 返ってきたりしても流れが分かれるよう、PID とプロセス内の通し番号も混ぜる
+	nonce := uint64(os.Getpid())<<40 ^ connRands.Add(1)
+	return rand.New(rand.NewPCG(binary.LittleEndian.Uint64(buf[:8]), binary.LittleEndian.Uint64(buf[8:])^nonce))
+}
+
+// jitteredDelay spreads d uniformly over [d-percent%, d+percent%]. The
+// result stays positive whenever d is, so jitter never turns the tarpit
+// into a busy loop; a jitter of 0 returns d unchanged.
+func jitteredDelay(rng *rand.Rand, d time.Duration, percent int) time.Duration {
+	if percent <= 0 || d <= 0 {
+		return d
+	}
+
+	span := d * time.Duration(percent) / 100
+	v := d - span + time.Duration(rng.Int64N(int64(2*span)+1))
+	if floor := min(d, time.Millisecond); v < floor {
+		v = floor
+	}
+	return v
+}
+
+// NewSeededRand returns a deterministic RNG for seed, as used with Config.Seed.
+func NewSeededRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), 0))
+}
+
+// LineSequence returns the first n random lines a connection would receive
+// with the given seed and maximum line length.
+func LineSequence(seed int64, maxLen, n int) []string {
+	rng := NewSeededRand(seed)
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = generateLine(rng, DefaultMinLineLength, maxLen, alphabetFor(CharsetASCII, StyleRandom, ""), "\r\n")
+	}
+	return lines
+}
+
+// generateLine returns a random line of minLen to maxLen bytes, including
+// the terminator term.
+func generateLine(rng *rand.Rand, minLen, maxLen int, a *alphabet, term string) string {
+	buf := make([]byte, maxLen)
+	return string(buf[:generateLineInto(buf, rng, minLen, maxLen, a, term)])
+}
+
+// generateLineInto is generateLine writing into buf, which must hold at least
+// maxLen bytes. It returns the line length and consumes the same random
+// numbers as generateLine, so both produce identical output.
+func generateLineInto(buf []byte, rng *rand.Rand, minLen, maxLen int, a *alphabet, term string) int {
+	// 本文は1バイト以上で、終端と合わせて minLen..maxLen。既定の CRLF と 3 なら従来と同じ乱数を引く
+	lo := max(1, minLen-len(term))
+	n := lo + rng.IntN(maxLen-len(term)-lo+1)
+
+	body := buf[:n]
+	switch {
+	case a.style == StyleWordlike:
+		a.fillWordlike(rng, body)
+	case a.charset == CharsetUTF8:
+		a.fillUTF8(rng, body)
+	default:
+		a.fill(rng, body)
+	}
+	if avoidSSHPrefix(body, term) {
+		body[0] = a.lead
+	}
+	return n + copy(buf[n:], term)
+}
+
+// avoidSSHPrefix rewrites a line body that would make the client see an
+// "SSH-" version line and disconnect with a protocol error. Without a
+// terminator the next line continues the same one, so a body that is only
+// the start of "SSH-" is rewritten too. It reports whether body changed.
+func avoidSSHPrefix(body []byte, term string) bool {
+	if len(body) == 0 {
+		return false
+	}
+	if strings.HasPrefix(string(body), "SSH-") || term == "" && strings.HasPrefix("SSH-", string(body)) {
+		body[0] = 'X'
+		return true
+	}
+	return false
+}
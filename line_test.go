@@ -0,0 +1,105 @@
+package orexis
+
+import (
+	mathrand "math/rand"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewConnRandDiverges(t *testing.T) {
+	// 同じ時刻に受け付けた接続でも、1行目から違う行を送る
+	a := alphabetFor(CharsetASCII, StyleRandom, "")
+	first := generateLine(newConnRand(0), MaxLineLengthLimit, MaxLineLengthLimit, a, "\r\n")
+	second := generateLine(newConnRand(0), MaxLineLengthLimit, MaxLineLengthLimit, a, "\r\n")
+	if first == second {
+		t.Fatalf("two unseeded connections got the same first line %q", first)
+	}
+}
+
+func TestGenerateLineIntoFixedLength(t *testing.T) {
+	// minLen == maxLen なら、どの終端でも常にちょうどその長さになる
+	a := alphabetFor(CharsetASCII, StyleRandom, "")
+	rng := NewSeededRand(1)
+	buf := make([]byte, MaxLineLengthLimit)
+	for _, term := range []string{"\r\n", "\n", ""} {
+		for _, n := range []int{3, 4, 64, MaxLineLengthLimit} {
+			for i := 0; i < 100; i++ {
+				if got := generateLineInto(buf, rng, n, n, a, term); got != n {
+					t.Fatalf("length %d, terminator %q: got a line of %d bytes", n, term, got)
+				}
+			}
+		}
+	}
+}
+
+func TestLineSequence(t *testing.T) {
+	// 同じ seed なら毎回同じ行になる。変わるなら -seed の再現性が壊れている
+	want := []string{"{,(1{xB]{RY57\r\n", "XO5NYYf 8u\r\n", "ZZ?XPs]Ga\r\n"}
+	if got := LineSequence(42, 16, 3); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("LineSequence(42, 16, 3) = %q, want %q", got, want)
+	}
+
+	for _, line := range LineSequence(7, 16, 1000) {
+		body, ok := strings.CutSuffix(line, "\r\n")
+		if !ok || strings.ContainsAny(body, "\r\n") || len(line) < DefaultMinLineLength || len(line) > 16 {
+			t.Fatalf("line %q is not a CRLF-terminated line of %d-16 bytes", line, DefaultMinLineLength)
+		}
+	}
+}
+
+var lineSink string
+
+// BenchmarkGenerateLine allocates a new line each time, as every line did
+// before clients reused one buffer.
+func BenchmarkGenerateLine(b *testing.B) {
+	a := alphabetFor(CharsetASCII, StyleRandom, "")
+	rng := NewSeededRand(1)
+	b.ReportAllocs()
+	for b.Loop() {
+		lineSink = generateLine(rng, DefaultMinLineLength, DefaultMaxLineLength, a, "\r\n")
+	}
+}
+
+// BenchmarkLineGenerator is the per-client path, which should not allocate.
+func BenchmarkLineGenerator(b *testing.B) {
+	c := DefaultConfig()
+	var conf atomic.Pointer[Config]
+	conf.Store(&c)
+	gen := newLineGenerator(&conf, NewSeededRand(1))
+	buf := make([]byte, MaxLineLengthLimit)
+	b.ReportAllocs()
+	for b.Loop() {
+		gen.Next(buf)
+	}
+}
+
+// BenchmarkLineRNG compares the per-connection PCG with the math/rand source
+// lines were drawn from before and with ChaCha8, on the ASCII line loop.
+func BenchmarkLineRNG(b *testing.B) {
+	a := alphabetFor(CharsetASCII, StyleRandom, "")
+	body := make([]byte, DefaultMaxLineLength-2)
+
+	b.Run("math-rand", func(b *testing.B) {
+		rng := mathrand.New(mathrand.NewSource(1))
+		for b.Loop() {
+			for i := range body {
+				body[i] = a.bytes[rng.Intn(len(a.bytes))]
+			}
+		}
+	})
+	for _, bench := range []struct {
+		name string
+		rng  *rand.Rand
+	}{
+		{"pcg", rand.New(rand.NewPCG(1, 2))},
+		{"chacha8", rand.New(rand.NewChaCha8([32]byte{}))},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				a.fill(bench.rng, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package orexis
+
+import "github.com/nexryai/orexis/internal/eventlog"
+
+// Log formats accepted by SetLogFormat.
+const (
+	LogFormatText = eventlog.FormatText
+	LogFormatJSON = eventlog.FormatJSON
+)
+
+// SetLogFormat selects text or JSON log lines. Logging goes through the
+// standard logger, so this applies to every Server in the process.
+func SetLogFormat(format string) error {
+	return eventlog.Setup(format)
+}
+
+// ログの実体は cmd/orexis と共有する internal/eventlog にある
+type field = eventlog.Field
+
+func kv(key string, value any) field {
+	return eventlog.F(key, value)
+}
+
+// quoted marks a value that may contain spaces, such as a line the client
+// sent, so that text mode writes it in double quotes.
+func quoted(s string) eventlog.Quoted { return eventlog.Quoted(s) }
+
+func logEvent(label string, fields ...field) { eventlog.Event(label, fields...) }
+func logError(op string, err error)          { eventlog.Error(op, err) }
+func logInfo(format string, args ...any)     { eventlog.Info(format, args...) }
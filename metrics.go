@@ -0,0 +1,94 @@
+package orexis
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// histogram is a minimal Prometheus-style histogram with fixed upper bounds.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) writeTo(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// connectionAgeBounds buckets current clients into under a minute, up to
+// ten minutes, up to an hour and longer.
+var connectionAgeBounds = []float64{60, 600, 3600}
+
+func writeMetric(w io.Writer, name, kind, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// MetricsHandler serves the server's counters in the Prometheus text format
+// on /metrics.
+func (s *Server) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		// ログの STATS と同じスナップショットから出し、接続数と累計が食い違わないようにする
+		st := s.Stats()
+		writeMetric(w, "orexis_current_clients", "gauge", "Number of clients currently trapped.", st.CurrentClients)
+		writeMetric(w, "orexis_total_connects", "counter", "Total number of accepted clients.", st.TotalConnects)
+		writeMetric(w, "orexis_rejected_connects", "counter", "Clients turned away because MaxClients was reached.", st.RejectedConnects)
+		writeMetric(w, "orexis_immediate_drops", "counter", "Clients that disconnected on their own before a single byte was sent to them.", st.ImmediateDrops)
+		writeMetric(w, "orexis_hooked_clients", "counter", "Clients that disconnected after receiving at least one byte.", st.HookedClients)
+		writeMetric(w, "orexis_distinct_ips", "gauge", "Approximate number of distinct source IPs seen since start.", st.TotalDistinctIPs)
+		writeMetric(w, "orexis_bytes_sent", "counter", "Total number of bytes sent to clients.", st.BytesSent)
+		writeMetric(w, "orexis_bytes_per_second", "gauge", "Send rate over the most recent STATS interval.", st.BytesPerSec)
+		writeMetric(w, "orexis_goroutines", "gauge", "Goroutines in the process at the most recent STATS line.", st.Goroutines)
+		writeMetric(w, "orexis_heap_alloc_bytes", "gauge", "Heap bytes allocated at the most recent STATS line.", st.HeapAlloc)
+		s.connDurations.writeTo(w, "orexis_connection_duration_seconds", "Time clients stayed trapped before disconnecting.")
+		s.lineLengths.writeTo(w, "orexis_line_length_bytes", "Length of the generated lines, terminator included; the count is the number of lines generated.")
+
+		// 今いる接続だけを対象に、スクレイプのたびに数え直す
+		ages := newHistogram(connectionAgeBounds)
+		for _, age := range s.clientAges() {
+			ages.Observe(age)
+		}
+		ages.writeTo(w, "orexis_connection_age_seconds", "How long the clients trapped right now have been connected.")
+	})
+	return mux
+}
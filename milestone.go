@@ -0,0 +1,84 @@
+package orexis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMilestones is the -milestones value used when the flag is not given.
+const DefaultMilestones = "1h,6h,24h,168h"
+
+// ParseMilestones parses a comma-separated list of increasing durations,
+// such as DefaultMilestones, for Config.Milestones. "" or "off" means none.
+func ParseMilestones(s string) ([]time.Duration, error) {
+	if s == "" || s == "off" {
+		return nil, nil
+	}
+	var ms []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("milestones %q: %w", s, err)
+		}
+		ms = append(ms, d)
+	}
+	return ms, validateMilestones(ms)
+}
+
+// FormatMilestones is the inverse of ParseMilestones: it lists ms in the
+// -milestones format, e.g. "1h,6h", or returns "off" for none.
+func FormatMilestones(ms []time.Duration) string {
+	if len(ms) == 0 {
+		return "off"
+	}
+	strs := make([]string, len(ms))
+	for i, d := range ms {
+		strs[i] = shortDuration(d)
+	}
+	return strings.Join(strs, ",")
+}
+
+func validateMilestones(ms []time.Duration) error {
+	for i, d := range ms {
+		if d <= 0 {
+			return fmt.Errorf("milestone %v must be positive", d)
+		}
+		if i > 0 && d <= ms[i-1] {
+			return fmt.Errorf("milestones must be increasing, got %v after %v", d, ms[i-1])
+		}
+	}
+	return nil
+}
+
+// checkMilestones logs MILESTONE for each Config.Milestones threshold cs
+// has passed since the last check. It runs after every write, so a client
+// is reported at most one Delay after it crosses the threshold.
+func (s *Server) checkMilestones(cs *clientState) {
+	ms := cs.conf.Load().Milestones
+	if len(ms) == 0 || !cs.logged {
+		return
+	}
+	trapped := time.Since(cs.start)
+	for _, m := range ms {
+		// Reload で一覧が変わっても、記録済みの閾値以下は出し直さない
+		if m <= cs.milestone || trapped < m {
+			continue
+		}
+		logEvent("MILESTONE", kv("id", cs.id), kv("host", cs.host), kv("trapped", shortDuration(m)))
+		cs.milestone = m
+	}
+}
+
+// shortDuration formats d without trailing zero units, e.g. "6h" rather
+// than "6h0m0s".
+func shortDuration(d time.Duration) string {
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
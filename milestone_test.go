@@ -0,0 +1,19 @@
+package orexis
+
+import "testing"
+
+func TestFormatMilestones(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{DefaultMilestones, DefaultMilestones},
+		{"90m,2h30m,3h", "1h30m,2h30m,3h"},
+		{"off", "off"},
+	} {
+		ms, err := ParseMilestones(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FormatMilestones(ms); got != tt.want {
+			t.Errorf("FormatMilestones(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package orexis
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Overrides replaces some of the server's settings for the clients of a
+// single listener, so that one process can run differently tuned traps on
+// different ports. Nil and empty fields keep the server's value.
+type Overrides struct {
+	Delay         *time.Duration
+	MaxLineLength *int
+	Banner        []string
+}
+
+func (o Overrides) apply(c Config) Config {
+	if o.Delay != nil {
+		c.Delay = *o.Delay
+	}
+	if o.MaxLineLength != nil {
+		c.MaxLineLength = *o.MaxLineLength
+	}
+	if len(o.Banner) > 0 {
+		c.Banner = o.Banner
+	}
+	return c
+}
+
+// Validate reports whether o applied to config is a valid configuration,
+// which is what ServeWith will require, so that a caller can check before
+// opening any listener.
+func (o Overrides) Validate(config Config) error {
+	c := o.apply(config)
+	return c.validate()
+}
+
+// listenerConfig is what the clients of one ServeWith listener follow: the
+// server's configuration with that listener's Overrides applied, kept up
+// to date by Reload.
+type listenerConfig struct {
+	overrides Overrides
+	config    atomic.Pointer[Config]
+}
+
+// ServeWith is Serve for a listener whose clients use the server's
+// configuration with o applied. MaxClients, AcceptRate and the counters
+// stay shared with every other listener. It fails without serving if the
+// result is not a valid configuration.
+func (s *Server) ServeWith(listener net.Listener, o Overrides) error {
+	lc := &listenerConfig{overrides: o}
+
+	s.mu.Lock()
+	cfg := o.apply(*s.config.Load())
+	if err := cfg.validate(); err != nil {
+		s.mu.Unlock()
+		listener.Close()
+		return fmt.Errorf("overrides: %w", err)
+	}
+	lc.config.Store(&cfg)
+	s.overridden[lc] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.overridden, lc)
+		s.mu.Unlock()
+	}()
+	return s.serve(listener, &lc.config)
+}
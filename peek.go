@@ -0,0 +1,63 @@
+package orexis
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// peekClient waits until deadline for the client to send something and
+// returns how many bytes arrived in the first read, and the first line of
+// them. Scanners that speak first usually send their SSH identification
+// string right away, so a short wait is enough; a silent client costs at
+// most the wait.
+func peekClient(conn net.Conn, deadline time.Time) (int, string) {
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+
+	// 最初の行のほかは使わないので、読んだ分は捨てる
+	var buf [MaxLineLengthLimit]byte
+	n, _ := conn.Read(buf[:])
+	line, _, _ := bytes.Cut(buf[:n], []byte("\n"))
+	return n, strings.TrimSuffix(string(line), "\r")
+}
+
+// sanitizeClientLine replaces everything but printable ASCII in a line the
+// client sent with '?', so that a hostile banner cannot put escape
+// sequences or fake log lines into the log.
+func sanitizeClientLine(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+		return r
+	}, line)
+}
+
+// readClientLine waits for the client's first line, normally its SSH
+// identification string, and returns it without the line ending. RFC 4253
+// caps that line at 255 bytes, so a client that sends MaxLineLengthLimit
+// bytes without a newline gets that much back. Cancelling ctx, as Shutdown
+// does, ends the wait early.
+func readClientLine(ctx context.Context, conn net.Conn, deadline time.Time) (string, error) {
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, 0, MaxLineLengthLimit)
+	for len(buf) < cap(buf) {
+		n, err := conn.Read(buf[len(buf):cap(buf)])
+		// 改行の後に続けて送られてきた分は捨てる
+		if i := bytes.IndexByte(buf[len(buf):len(buf)+n], '\n'); i >= 0 {
+			return strings.TrimSuffix(string(buf[:len(buf)+i]), "\r"), nil
+		}
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,18 @@
+package orexis
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// clientPoller drives many trapped clients from a single event loop instead
+// of one goroutine each. Implementations are platform specific; see
+// newPoller.
+type clientPoller interface {
+	// add takes ownership of conn. The poller is responsible for calling
+	// beginClient/endClient and for closing the connection.
+	add(conn net.Conn, conf *atomic.Pointer[Config])
+	// close stops the event loop and releases its resources. Shutdown calls
+	// it once every client given to add has ended.
+	close()
+}
@@ -0,0 +1,411 @@
+package orexis
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pollClient is one trapped connection owned by the epoll loop.
+type pollClient struct {
+	p     *epollPoller
+	fd    int
+	state *clientState
+	next  time.Time
+	index int
+	lines LineGenerator
+	// 最初に送る行 (-ssh-banner)。送ったら空にする
+	pending string
+	// Dribble で送りかけの行の残り。scratch は全接続で共有なのでコピーして持つ
+	rest []byte
+	// 送信バッファが詰まり始めた時刻。write-timeout の判定に使う
+	stalledSince time.Time
+	// EAGAIN の後、書けるようになるのを EPOLLOUT で待っている
+	waitingOut bool
+}
+
+// events is the epoll interest set for c: hang-ups only, plus EPOLLOUT
+// while a write is waiting for room in the send buffer.
+func (c *pollClient) events() uint32 {
+	// 受信側を閉じた接続では EPOLLRDHUP がすぐ立つので、EPOLLHUP/EPOLLERR だけを待つ
+	var events uint32 = unix.EPOLLRDHUP
+	if c.state.readClosed {
+		events = 0
+	}
+	if c.waitingOut {
+		events |= unix.EPOLLOUT
+	}
+	return events
+}
+
+// setWaitingOut adds or removes EPOLLOUT from c's interest set.
+func (p *epollPoller) setWaitingOut(c *pollClient, on bool) {
+	if c.waitingOut == on {
+		return
+	}
+	c.waitingOut = on
+	ev := unix.EpollEvent{Events: c.events(), Fd: int32(c.fd)}
+	if err := unix.EpollCtl(p.epfd, unix.EPOLL_CTL_MOD, c.fd, &ev); err != nil {
+		// 次の行の時刻にはどのみち書き直すので、そのまま続ける
+		logError("epoll_ctl", err)
+	}
+}
+
+// Close asks the loop to drop the client. It is safe to call from any
+// goroutine and is what Shutdown uses to force clients out, so the client is
+// logged with reason=shutdown.
+func (c *pollClient) Close() error {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	// 止めた後の wakefd は閉じていて、別のファイルに使い回されているかもしれない
+	if c.p.stopping {
+		return nil
+	}
+	c.p.pendingClose = append(c.p.pendingClose, c)
+	c.p.wake()
+	return nil
+}
+
+// pollQueue orders clients by the time their next line is due.
+type pollQueue []*pollClient
+
+func (q pollQueue) Len() int           { return len(q) }
+func (q pollQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q pollQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *pollQueue) Push(x any) {
+	c := x.(*pollClient)
+	c.index = len(*q)
+	*q = append(*q, c)
+}
+
+func (q *pollQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return c
+}
+
+// epollPoller writes one line to each client when its timer fires, and uses
+// epoll only to notice peers hanging up between lines, much like endlessh.
+type epollPoller struct {
+	s      *Server
+	epfd   int
+	wakefd int
+
+	mu           sync.Mutex
+	pendingAdd   []*pollClient
+	pendingClose []*pollClient
+	stopping     bool
+	// ループが抜けて epfd と wakefd を閉じたら閉じる
+	stopped chan struct{}
+
+	// 以下はイベントループのゴルーチンからのみ触る
+	clients map[int]*pollClient
+	queue   pollQueue
+	rng     *rand.Rand
+	scratch []byte
+}
+
+func newPoller(s *Server) (clientPoller, error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	wakefd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, err
+	}
+	ev := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wakefd)}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, wakefd, &ev); err != nil {
+		unix.Close(wakefd)
+		unix.Close(epfd)
+		return nil, err
+	}
+
+	p := &epollPoller{
+		s:       s,
+		epfd:    epfd,
+		wakefd:  wakefd,
+		stopped: make(chan struct{}),
+		clients: make(map[int]*pollClient),
+		// ループは単一スレッドなので乱数源は全接続で共有できる
+		rng:     newConnRand(s.config.Load().Seed),
+		scratch: make([]byte, MaxLineLengthLimit),
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *epollPoller) add(conn net.Conn, conf *atomic.Pointer[Config]) {
+	cs := p.s.beginClient(conn, conf)
+
+	fd, err := dupConnFD(conn)
+	// 以降は複製した fd だけを使う
+	conn.Close()
+	if err != nil {
+		logError("Poll", err)
+		p.s.endClient(cs, "")
+		return
+	}
+
+	// ループは単一スレッドなので、生成器も共有の乱数源を使える
+	c := &pollClient{p: p, fd: fd, state: cs, pending: initialLine(conf.Load()), lines: newLineGenerator(conf, p.rng)}
+	p.s.track(c, cs)
+
+	p.mu.Lock()
+	p.pendingAdd = append(p.pendingAdd, c)
+	p.mu.Unlock()
+	p.wake()
+}
+
+// dupConnFD returns a non-blocking duplicate of conn's socket so it can be
+// driven outside the Go netpoller.
+func dupConnFD(conn net.Conn) (int, error) {
+	sc, ok := syscallConnOf(conn)
+	if !ok {
+		return -1, errors.New("connection does not expose a file descriptor")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	fd := -1
+	var dupErr error
+	if err := raw.Control(func(s uintptr) {
+		fd, dupErr = unix.FcntlInt(s, unix.F_DUPFD_CLOEXEC, 0)
+	}); err != nil {
+		return -1, err
+	}
+	if dupErr != nil {
+		return -1, dupErr
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func syscallConnOf(conn net.Conn) (syscall.Conn, bool) {
+	for {
+		if sc, ok := conn.(syscall.Conn); ok {
+			return sc, true
+		}
+		nc, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil, false
+		}
+		conn = nc.NetConn()
+	}
+}
+
+func (p *epollPoller) close() {
+	p.mu.Lock()
+	p.stopping = true
+	p.wake()
+	p.mu.Unlock()
+	<-p.stopped
+}
+
+func (p *epollPoller) wake() {
+	var buf [8]byte
+	binary.NativeEndian.PutUint64(buf[:], 1)
+	// EAGAIN はカウンタが溢れそうなだけで、ループはどのみち起きる
+	unix.Write(p.wakefd, buf[:])
+}
+
+func (p *epollPoller) run() {
+	events := make([]unix.EpollEvent, 256)
+
+	for {
+		timeout := -1
+		if len(p.queue) > 0 {
+			d := time.Until(p.queue[0].next)
+			// 切り捨てると期限の直前に起きて空回りするので切り上げる
+			timeout = int((d + time.Millisecond - 1) / time.Millisecond)
+			if timeout < 0 {
+				timeout = 0
+			}
+		}
+
+		n, err := unix.EpollWait(p.epfd, events, timeout)
+		if err != nil && !errors.Is(err, unix.EINTR) {
+			logError("epoll_wait", err)
+			continue
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == p.wakefd {
+				var buf [8]byte
+				unix.Read(p.wakefd, buf[:])
+				continue
+			}
+			c, ok := p.clients[fd]
+			if !ok {
+				continue
+			}
+			if events[i].Events&(unix.EPOLLRDHUP|unix.EPOLLHUP|unix.EPOLLERR) != 0 {
+				// goroutine モードで書き込みが EPIPE になるのと同じ扱い
+				p.remove(c, "peer-reset")
+				continue
+			}
+			if events[i].Events&unix.EPOLLOUT != 0 {
+				// 詰まっていた行をすぐに送り直す
+				p.setWaitingOut(c, false)
+				c.next = time.Now()
+				heap.Fix(&p.queue, c.index)
+			}
+		}
+
+		if p.processPending() {
+			unix.Close(p.wakefd)
+			unix.Close(p.epfd)
+			close(p.stopped)
+			return
+		}
+
+		// Delay が 0 だと書いた直後にまた期限が来るので、1周あたり各接続1回までにする
+		now := time.Now()
+		for budget := len(p.queue); budget > 0 && len(p.queue) > 0 && !p.queue[0].next.After(now); budget-- {
+			p.writeLine(p.queue[0], now)
+		}
+	}
+}
+
+// processPending applies the adds and closes queued by other goroutines
+// and reports whether close has asked the loop to stop.
+func (p *epollPoller) processPending() bool {
+	p.mu.Lock()
+	adds, closes, stopping := p.pendingAdd, p.pendingClose, p.stopping
+	p.pendingAdd, p.pendingClose = nil, nil
+	p.mu.Unlock()
+
+	for _, c := range adds {
+		ev := unix.EpollEvent{Events: c.events(), Fd: int32(c.fd)}
+		if err := unix.EpollCtl(p.epfd, unix.EPOLL_CTL_ADD, c.fd, &ev); err != nil {
+			logError("epoll_ctl", err)
+			p.release(c, "")
+			continue
+		}
+		p.clients[c.fd] = c
+		config := c.state.conf.Load()
+		c.next = time.Now().Add(jitteredDelay(p.rng, config.FirstDelay, config.Jitter))
+		heap.Push(&p.queue, c)
+	}
+
+	for _, c := range closes {
+		// fd は再利用されるので、同じクライアントか確かめてから外す
+		if p.clients[c.fd] == c {
+			p.remove(c, "shutdown")
+		}
+	}
+	return stopping
+}
+
+func (p *epollPoller) writeLine(c *pollClient, now time.Time) {
+	config := c.state.conf.Load()
+	if lifetimeExceeded(c.state, config) {
+		p.remove(c, "max-lifetime", kv("seconds", int64(now.Sub(c.state.start).Seconds())))
+		return
+	}
+
+	var line []byte
+	switch {
+	case len(c.rest) > 0:
+		line = c.rest
+	case c.pending != "":
+		line = []byte(c.pending)
+	default:
+		line = p.scratch[:p.s.nextLine(c.lines, p.scratch)]
+	}
+	chunk := nextChunk(line, c.state, config)
+	if p.s.sendLimiter != nil {
+		// ループは止められないので、MaxBPS の枠が空く時刻まで後回しにする
+		r := p.s.sendLimiter.ReserveN(now, len(chunk))
+		if d := r.DelayFrom(now); d > 0 {
+			r.CancelAt(now)
+			if c.pending == "" && len(c.rest) == 0 {
+				c.rest = append(c.rest[:0], line...)
+			}
+			c.next = now.Add(d)
+			heap.Fix(&p.queue, c.index)
+			return
+		}
+	}
+
+	n, err := unix.SendmsgN(c.fd, chunk, nil, nil, unix.MSG_NOSIGNAL)
+	switch {
+	case errors.Is(err, unix.EAGAIN):
+		// ノンブロッキングなので書き込みは止まらない。詰まったままの時間で判定する
+		if c.stalledSince.IsZero() {
+			c.stalledSince = now
+		} else if config.WriteTimeout > 0 && now.Sub(c.stalledSince) >= config.WriteTimeout {
+			p.remove(c, "write-timeout")
+			return
+		}
+		// 切断はせず、同じ行を書けるようになった時点で送り直す。それまでは write-timeout の期限にだけ起きる
+		if c.pending == "" && len(c.rest) == 0 {
+			c.rest = append(c.rest[:0], line...)
+		}
+		p.setWaitingOut(c, true)
+		if config.WriteTimeout > 0 {
+			c.next = c.stalledSince.Add(config.WriteTimeout)
+			heap.Fix(&p.queue, c.index)
+			return
+		}
+	case err != nil:
+		p.remove(c, writeErrorReason(err))
+		return
+	default:
+		c.pending = ""
+		c.stalledSince = time.Time{}
+		p.setWaitingOut(c, false)
+		p.s.addSent(c.state, n)
+		// 送り切れなかった残り (Dribble の残りや、送信バッファが詰まりかけて途中までしか
+		// 入らなかった分) は次の書き込みで送る。line が c.rest のときは前に詰めるだけになる
+		c.rest = append(c.rest[:0], line[n:]...)
+		if bytesExceeded(c.state, config) {
+			p.remove(c, "max-bytes")
+			return
+		}
+	}
+
+	c.next = now.Add(jitteredDelay(p.rng, lineDelay(c.state, config), config.Jitter))
+	heap.Fix(&p.queue, c.index)
+}
+
+func (p *epollPoller) remove(c *pollClient, reason string, extra ...field) {
+	unix.EpollCtl(p.epfd, unix.EPOLL_CTL_DEL, c.fd, nil)
+	delete(p.clients, c.fd)
+	heap.Remove(&p.queue, c.index)
+	p.release(c, reason, extra...)
+}
+
+// release closes the socket and does the per-client cleanup for a client
+// that is no longer in the loop.
+func (p *epollPoller) release(c *pollClient, reason string, extra ...field) {
+	if c.state.reset.Load() {
+		unix.SetsockoptLinger(c.fd, unix.SOL_SOCKET, unix.SO_LINGER, &unix.Linger{Onoff: 1, Linger: 0})
+	}
+	unix.Close(c.fd)
+
+	p.s.untrack(c, c.state)
+	p.s.endClient(c.state, reason, extra...)
+}
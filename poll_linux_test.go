@@ -0,0 +1,60 @@
+package orexis
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPollShutdownReleasesLoop(t *testing.T) {
+	openFDs := func() int {
+		fds, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip(err)
+		}
+		return len(fds)
+	}
+	fds, goroutines := openFDs(), runtime.NumGoroutine()
+
+	// New と Shutdown を繰り返しても、epoll のループと fd が残らない
+	for range 5 {
+		c := DefaultConfig()
+		c.Poll = true
+		c.Delay = 10 * time.Millisecond
+		srv, err := New(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.Serve(ln)
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		srv.Shutdown(ctx)
+		conn.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines left running, had %d", n, goroutines)
+	}
+	if n := openFDs(); n > fds {
+		t.Errorf("%d file descriptors open, had %d", n, fds)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package orexis
+
+import "errors"
+
+func newPoller(s *Server) (clientPoller, error) {
+	return nil, errors.New("poll mode is only supported on Linux")
+}
@@ -0,0 +1,136 @@
+package orexis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PROXY protocol v1 のヘッダは CRLF 込みで最大 107 バイト
+const proxyHeaderMaxLen = 107
+
+// proxiedConn reports the client address from the PROXY header instead of
+// the load balancer's, and first serves whatever the client sent right
+// after the header in the same read.
+type proxiedConn struct {
+	net.Conn
+	// nil なら UNKNOWN で、接続元をそのまま使う
+	remote net.Addr
+	r      *bufio.Reader
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+func (c *proxiedConn) Read(b []byte) (int, error) {
+	// ヘッダと一緒に読んだ分を渡し切ったら、後は直接読む
+	if c.r.Buffered() > 0 {
+		return c.r.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// NetConn returns the underlying connection, mirroring tls.Conn.
+func (c *proxiedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// tcpConnOf unwraps conn down to the *net.TCPConn, if there is one.
+func tcpConnOf(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// readProxyHeader consumes a PROXY protocol v1 header from conn and returns
+// a connection whose RemoteAddr is the original client's. A zero deadline
+// waits for the header until ctx is canceled, as a forced Shutdown does.
+func readProxyHeader(ctx context.Context, conn net.Conn, deadline time.Time) (net.Conn, error) {
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	// ヘッダの後まで読み過ぎた分は proxiedConn が Read で返す
+	r := bufio.NewReaderSize(conn, proxyHeaderMaxLen+1)
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errors.New("header too long")
+		}
+		return nil, err
+	}
+	if len(line) > proxyHeaderMaxLen {
+		return nil, errors.New("header too long")
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseProxyHeader(string(line))
+	if err != nil {
+		return nil, err
+	}
+	return &proxiedConn{Conn: conn, remote: addr, r: r}, nil
+}
+
+// parseProxyHeader parses a single "PROXY ...\r\n" line. It returns a nil
+// address for the UNKNOWN protocol.
+func parseProxyHeader(line string) (net.Addr, error) {
+	if !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("header not terminated by CRLF")
+	}
+	fields := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, errors.New("missing PROXY signature")
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("expected 6 fields, got %d", len(fields))
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source address %q", fields[2])
+	}
+	if (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("source address %q does not match %s", fields[2], fields[1])
+	}
+	if dst := net.ParseIP(fields[3]); dst == nil || (dst.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("invalid destination address %q", fields[3])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port %q", fields[4])
+	}
+	if _, err := strconv.ParseUint(fields[5], 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid destination port %q", fields[5])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
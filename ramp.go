@@ -0,0 +1,102 @@
+package orexis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ramp makes a new client's delay start short and grow towards
+// Config.Delay, so that the server only gradually turns suspiciously slow.
+// The zero Ramp is off.
+type Ramp struct {
+	// 最初の書き込みの後の待ち時間。0 なら無効で最初から Delay
+	Start time.Duration
+	// 線形なら書き込みごとに足す時間
+	Step time.Duration
+	// 0 でなければ指数で、書き込みごとに掛ける倍率 (1 より大きい)
+	Factor float64
+}
+
+// ParseRamp parses a -ramp value: "linear:START:STEP" such as
+// "linear:200ms:500ms", "exp:START:FACTOR" such as "exp:100ms:2", or ""
+// or "off" for no ramp.
+func ParseRamp(s string) (Ramp, error) {
+	if s == "" || s == "off" {
+		return Ramp{}, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return Ramp{}, fmt.Errorf("ramp %q: want linear:START:STEP or exp:START:FACTOR", s)
+	}
+	start, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return Ramp{}, fmt.Errorf("ramp %q: %w", s, err)
+	}
+
+	r := Ramp{Start: start}
+	switch parts[0] {
+	case "linear":
+		r.Step, err = time.ParseDuration(parts[2])
+	case "exp":
+		r.Factor, err = strconv.ParseFloat(parts[2], 64)
+	default:
+		return Ramp{}, fmt.Errorf("ramp %q: unknown growth %q (want linear or exp)", s, parts[0])
+	}
+	if err != nil {
+		return Ramp{}, fmt.Errorf("ramp %q: %w", s, err)
+	}
+	// 倍率 0 は線形と区別がつかないので、exp なら validate の前に見る
+	if parts[0] == "exp" {
+		if err := checkFactor(r.Factor); err != nil {
+			return Ramp{}, err
+		}
+	}
+	return r, r.validate()
+}
+
+func (r Ramp) validate() error {
+	if r.Start < 0 {
+		return fmt.Errorf("ramp start must not be negative")
+	}
+	if r.Start == 0 {
+		return nil
+	}
+	// 伸びないと Delay に届かないまま短い間隔で送り続けてしまう
+	if r.Factor != 0 {
+		return checkFactor(r.Factor)
+	}
+	if r.Step <= 0 {
+		return fmt.Errorf("ramp step must be positive")
+	}
+	return nil
+}
+
+func checkFactor(f float64) error {
+	if !(f > 1) || math.IsInf(f, 0) {
+		return fmt.Errorf("ramp factor %v must be greater than 1", f)
+	}
+	return nil
+}
+
+// delay returns the wait after the n-th write (counting from 0), capped
+// at max. It returns max when the ramp is off.
+func (r Ramp) delay(n int64, max time.Duration) time.Duration {
+	if r.Start <= 0 || r.Start >= max {
+		return max
+	}
+	if r.Factor != 0 {
+		if d := float64(r.Start) * math.Pow(r.Factor, float64(n)); d < float64(max) {
+			return time.Duration(d)
+		}
+		return max
+	}
+	// n*Step が溢れないよう、先に Delay に届く回数と比べる
+	if n > int64((max-r.Start)/r.Step) {
+		return max
+	}
+	return min(r.Start+time.Duration(n)*r.Step, max)
+}
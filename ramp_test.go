@@ -0,0 +1,48 @@
+package orexis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRampDelay(t *testing.T) {
+	const ms = time.Millisecond
+	for _, tt := range []struct {
+		ramp string
+		n    int64
+		want time.Duration
+	}{
+		{"linear:200ms:100ms", 0, 200 * ms},
+		// Delay までちょうど割り切れるなら、届く回で初めて Delay になる
+		{"linear:200ms:100ms", 1, 300 * ms},
+		{"linear:200ms:100ms", 2, 400 * ms},
+		{"linear:200ms:100ms", 3, 400 * ms},
+		// 割り切れなければ、越える回が Delay で頭打ちになる
+		{"linear:200ms:150ms", 0, 200 * ms},
+		{"linear:200ms:150ms", 1, 350 * ms},
+		{"linear:200ms:150ms", 2, 400 * ms},
+		{"linear:200ms:500ms", 0, 200 * ms},
+		{"linear:200ms:500ms", 1, 400 * ms},
+		{"linear:200ms:1ns", 1 << 62, 400 * ms},
+		{"exp:100ms:2", 0, 100 * ms},
+		{"exp:100ms:2", 2, 400 * ms},
+		{"exp:100ms:2", 3, 400 * ms},
+		{"linear:500ms:100ms", 0, 400 * ms},
+		{"off", 0, 400 * ms},
+	} {
+		r, err := ParseRamp(tt.ramp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.delay(tt.n, 400*ms); got != tt.want {
+			t.Errorf("%s: delay(%d, 400ms) = %v, want %v", tt.ramp, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestParseRampExpFactor(t *testing.T) {
+	_, err := ParseRamp("exp:100ms:0")
+	if want := "ramp factor 0 must be greater than 1"; err == nil || err.Error() != want {
+		t.Fatalf("ParseRamp(exp:100ms:0) error = %v, want %q", err, want)
+	}
+}
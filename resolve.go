@@ -0,0 +1,110 @@
+package orexis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	resolveWorkers   = 2
+	resolveQueueSize = 256
+	resolveTimeout   = 5 * time.Second
+	// 同じ相手は何度も来るので、結果を TTL の間使い回して DNS を叩きすぎないようにする
+	resolveTTL = time.Hour
+	// これを超えたら期限切れを捨て、それでも多ければ全部捨てる
+	resolveCacheSize = 10000
+)
+
+// resolver looks up PTR names for client addresses in the background. The
+// tarpit path only ever reads the cache, so a slow DNS server can delay the
+// annotation but never a client.
+type resolver struct {
+	queue chan string
+
+	mu      sync.Mutex
+	cache   map[string]ptrEntry
+	pending map[string]bool
+}
+
+type ptrEntry struct {
+	name    string
+	expires time.Time
+}
+
+func startResolver() *resolver {
+	r := &resolver{
+		queue:   make(chan string, resolveQueueSize),
+		cache:   make(map[string]ptrEntry),
+		pending: make(map[string]bool),
+	}
+	for i := 0; i < resolveWorkers; i++ {
+		go r.worker()
+	}
+	return r
+}
+
+// ptr returns the cached name for host, "-" if the lookup failed, or ""
+// if it is not known yet, in which case a lookup is queued.
+func (r *resolver) ptr(host string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.cache[host]; ok && time.Now().Before(e.expires) {
+		return e.name
+	}
+	if !r.pending[host] {
+		select {
+		case r.queue <- host:
+			r.pending[host] = true
+		default:
+			// 溢れたら次に同じ相手が来たときにまた試す
+		}
+	}
+	return ""
+}
+
+func (r *resolver) worker() {
+	for host := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		names, err := net.DefaultResolver.LookupAddr(ctx, host)
+		cancel()
+
+		name := "-"
+		if err == nil && len(names) > 0 {
+			name = strings.TrimSuffix(names[0], ".")
+		}
+		r.store(host, name)
+	}
+}
+
+func (r *resolver) store(host, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pending, host)
+	if len(r.cache) >= resolveCacheSize {
+		now := time.Now()
+		for h, e := range r.cache {
+			if now.After(e.expires) {
+				delete(r.cache, h)
+			}
+		}
+		if len(r.cache) >= resolveCacheSize {
+			clear(r.cache)
+		}
+	}
+	r.cache[host] = ptrEntry{name: name, expires: time.Now().Add(resolveTTL)}
+}
+
+// ptrField returns the ptr= field for host, or false if there is nothing
+// to add yet.
+func (s *Server) ptrField(host string) (field, bool) {
+	if s.resolver == nil || host == "" {
+		return field{}, false
+	}
+	name := s.resolver.ptr(host)
+	return kv("ptr", name), name != ""
+}
@@ -0,0 +1,608 @@
+// Package orexis is an SSH tarpit. It accepts connections and slowly feeds
+// them an endless pre-banner, keeping scanners busy for as long as they are
+// willing to wait. The orexis command is a thin wrapper around Server.
+package orexis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+	"golang.org/x/time/rate"
+)
+
+// MaxClients で断った REJECT のログを出す最短の間隔
+const rejectLogInterval = time.Second
+
+// ErrServerClosed is returned by Serve once Shutdown has been called.
+var ErrServerClosed = errors.New("orexis: server closed")
+
+// Server traps the clients accepted from one or more listeners. All
+// listeners passed to Serve share the same counters and MaxClients.
+type Server struct {
+	// 実行中の設定。Reload で差し替えられるため、接続ごとのループは毎回これを読む
+	config atomic.Pointer[Config]
+
+	currentClients atomic.Int64
+	// Serve が受け付けてから beginClient までの接続数。MaxClients の判定に含め、
+	// 直後の Accept で数え漏らさないようにする
+	admitting     atomic.Int64
+	totalConnects atomic.Int64
+	bytesSent     atomic.Int64
+	// currentClients の最大値 (RollingPeak なら前回の STATS 以降の最大値)
+	peakClients atomic.Int64
+	// MaxClients に達していて断った接続の数。totalConnects には含めない
+	rejectedConnects atomic.Int64
+	// 1行も送れずに相手が切断した接続 (SYN スキャンなど) と、1行以上送れた接続の数
+	immediateDrops atomic.Int64
+	hookedClients  atomic.Int64
+	// 接続と切断で一緒に変わるカウンタ (currentClients、totalConnects、peakClients、
+	// immediateDrops、hookedClients) を食い違いなく読むためのロック。更新側は何本でも
+	// 同時に進めてよいので RLock を取り、counters だけが Lock を取って更新の途中を見ないようにする
+	countersMu sync.RWMutex
+
+	// 満杯の間は REJECT が大量に出るので、rejectLogInterval に1回だけ出す
+	rejectMu         sync.Mutex
+	lastRejectLog    time.Time
+	rejectSuppressed int
+
+	// Serve 中のリスナーと、シャットダウン時に強制切断するためのアクティブな接続の一覧
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	// ServeWith 中のリスナーごとの設定。Reload のたびに作り直す
+	overridden map[*listenerConfig]struct{}
+	// 送信元ごとのアクティブな接続。Kick で IP から引けるようにする
+	conns     map[string]map[io.Closer]*clientState
+	closed    bool
+	clientsWG sync.WaitGroup
+	// PauseAtMax で Accept を止めている Serve を、空きができたときと Shutdown のときに起こす
+	slotFree *sync.Cond
+	// 猶予が切れたらキャンセルし、待機中の接続を reason=shutdown で終わらせる
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Shutdown が始まるまでの間、Serve が1つでも動いていれば true
+	ready atomic.Bool
+
+	// AcceptRate が指定されたときだけ設定される
+	acceptLimiter *rate.Limiter
+	// MaxBPS が指定されたときだけ設定される。全接続の書き込みで共有する
+	sendLimiter *rate.Limiter
+
+	// SetReadBuffer の失敗は接続ごとに出るとうるさいので最初の1回だけ警告する
+	readBufferWarn sync.Once
+
+	// 送信元IPごとの同時接続数
+	perIPMu     sync.Mutex
+	perIPCounts map[string]int
+	// 送信元IPごとの新規接続レート (PerIPRate)
+	perIPRate *ipRateLimiter
+
+	// 前回の STATS 時点の送信量。BytesPerSec の計算に使う
+	statsMu        sync.Mutex
+	lastStatsTime  time.Time
+	lastStatsBytes int64
+	// 直近の区間の送信レート。メトリクスからも同じ値を返す
+	lastBytesPerSec atomic.Int64
+	// 直近の STATS 時点のゴルーチン数とヒープ使用量
+	lastGoroutines atomic.Int64
+	lastHeapAlloc  atomic.Int64
+	stopStats      chan struct{}
+
+	connDurations *histogram
+	// 生成した行の長さ (終端を含むバイト数)。SSHBanner は含めない
+	lineLengths *histogram
+
+	// TopIPs が指定されたときだけ設定される
+	ipCounts *ipCounter
+	// 送信元の種類の数 (概算)。STATS の区間ごとと起動してからの2つ
+	distinct *distinctIPs
+	// ServeKnock のポートに接続してきた送信元と、その期限
+	knocks *knockList
+
+	// それぞれ GeoIPPath、フック、StatsdAddr、Poll が指定されたときだけ設定される
+	geoDB  *geoip2.Reader
+	hooks  *hookRunner
+	statsd *statsdClient
+	poll   clientPoller
+	// Resolve が指定されたときだけ設定される
+	resolver *resolver
+}
+
+// New validates config and prepares a server. It opens the GeoIP database
+// and starts the hook workers, poller and STATS reporter if config asks for
+// them.
+func New(config Config) (*Server, error) {
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if config.TLS != nil && config.Poll {
+		logInfo("Warning: poll mode does not support TLS, TLS clients get their own goroutine")
+	}
+
+	s := &Server{
+		listeners:     make(map[net.Listener]struct{}),
+		overridden:    make(map[*listenerConfig]struct{}),
+		conns:         make(map[string]map[io.Closer]*clientState),
+		perIPCounts:   make(map[string]int),
+		lastStatsTime: time.Now(),
+		stopStats:     make(chan struct{}),
+		// 接続時間 (秒) のバケット。タールピットなので長い側を厚めに取る
+		connDurations: newHistogram([]float64{1, 10, 60, 300, 900, 1800, 3600, 21600, 86400}),
+		// 既定の -l 32 の前後を細かく、上は MaxLineLengthLimit まで
+		lineLengths: newHistogram([]float64{8, 16, 24, 32, 48, 64, 128, MaxLineLengthLimit}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.slotFree = sync.NewCond(&s.mu)
+	s.config.Store(&config)
+
+	if config.StateFile != "" {
+		s.loadState(config.StateFile)
+	}
+
+	if config.GeoIPPath != "" {
+		db, err := geoip2.Open(config.GeoIPPath)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: %w", err)
+		}
+		s.geoDB = db
+	}
+
+	if config.OnAcceptExec != "" || config.WebhookURL != "" {
+		h, err := startHooks(config.OnAcceptExec, config.WebhookURL)
+		if err != nil {
+			return nil, fmt.Errorf("hooks: %w", err)
+		}
+		s.hooks = h
+	}
+
+	if config.StatsdAddr != "" {
+		c, err := startStatsd(config.StatsdAddr, &s.bytesSent)
+		if err != nil {
+			return nil, fmt.Errorf("statsd: %w", err)
+		}
+		s.statsd = c
+	}
+
+	if config.Resolve {
+		s.resolver = startResolver()
+	}
+
+	if config.AcceptRate > 0 {
+		// バーストは1秒分まで許す
+		s.acceptLimiter = rate.NewLimiter(rate.Limit(config.AcceptRate), max(1, int(config.AcceptRate)))
+	}
+	if config.MaxBPS > 0 {
+		// 1行はまとめて書くので、バーストは最低でも1行分にする
+		s.sendLimiter = rate.NewLimiter(rate.Limit(config.MaxBPS), max(MaxLineLengthLimit, int(config.MaxBPS)))
+	}
+
+	if config.Poll {
+		p, err := newPoller(s)
+		if err != nil {
+			logInfo("Poll mode unavailable, falling back to goroutines: %v", err)
+		} else {
+			s.poll = p
+		}
+	}
+
+	if config.TopIPs > 0 {
+		s.ipCounts = newIPCounter()
+	}
+	s.distinct = newDistinctIPs()
+	s.knocks = newKnockList()
+	s.perIPRate = newIPRateLimiter()
+
+	if config.StatsInterval > 0 {
+		go s.statsReporter(config.StatsInterval)
+	}
+	return s, nil
+}
+
+// Config returns the configuration currently in effect.
+func (s *Server) Config() Config {
+	return *s.config.Load()
+}
+
+// Reload swaps in a new configuration for clients already trapped and those
+// still to come. Fields marked "New only" keep their original effect. On
+// error the running configuration is left untouched. Listeners served with
+// ServeWith get config with their Overrides applied.
+func (s *Server) Reload(config Config) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old, err := s.swapConfig(&config)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logEvent("RELOAD",
+		kv("delay", fmt.Sprintf("%v->%v", old.Delay, config.Delay)),
+		kv("max_line_length", fmt.Sprintf("%d->%d", old.MaxLineLength, config.MaxLineLength)),
+		kv("max_clients", fmt.Sprintf("%d->%d", old.MaxClients, config.MaxClients)),
+	)
+	return nil
+}
+
+// swapConfig installs config, which must already be valid, as the running
+// configuration and rebuilds the ServeWith listeners' from it. It must be
+// called with s.mu held.
+func (s *Server) swapConfig(config *Config) (*Config, error) {
+	// リスナーごとの設定も全部通ることを確かめてから差し替える
+	merged := make(map[*listenerConfig]*Config, len(s.overridden))
+	for lc := range s.overridden {
+		c := lc.overrides.apply(*config)
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("listener overrides: %w", err)
+		}
+		merged[lc] = &c
+	}
+	old := s.config.Swap(config)
+	for lc, c := range merged {
+		lc.config.Store(c)
+	}
+	// MaxClients が増えていれば止めていた Accept を再開させる
+	s.slotFree.Broadcast()
+	return old, nil
+}
+
+// Serve accepts clients from listener until it is closed or fails
+// permanently, and closes it on return. After Shutdown it returns
+// ErrServerClosed.
+func (s *Server) Serve(listener net.Listener) error {
+	return s.serve(listener, &s.config)
+}
+
+// serve runs the accept loop for listener, whose clients follow conf.
+func (s *Server) serve(listener net.Listener, conf *atomic.Pointer[Config]) error {
+	defer listener.Close()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+	s.ready.Store(true)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, listener)
+		s.mu.Unlock()
+	}()
+
+	var backoff acceptBackoff
+	for {
+		if !s.waitForSlot() {
+			return ErrServerClosed
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			if isTransientAcceptError(err) {
+				backoff.wait(err)
+				continue
+			}
+			return err
+		}
+		backoff.reset()
+
+		if s.acceptLimiter != nil && !s.acceptLimiter.Allow() {
+			host, _ := splitAddr(conn.RemoteAddr())
+			logEvent("THROTTLE", kv("host", host))
+			conn.Close()
+			continue
+		}
+
+		cfg := s.config.Load()
+		if s.clientCount() >= cfg.MaxClients {
+			s.rejectFull(conn)
+			continue
+		}
+
+		s.admitting.Add(1)
+		s.clientsWG.Add(1)
+		go s.admitClient(conn, conf)
+	}
+}
+
+// rejectFull closes a client turned away because MaxClients is reached.
+func (s *Server) rejectFull(conn net.Conn) {
+	host, _ := splitAddr(conn.RemoteAddr())
+	conn.Close()
+	s.rejectedConnects.Add(1)
+
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastRejectLog) < rejectLogInterval {
+		s.rejectSuppressed++
+		return
+	}
+	fields := []field{kv("host", host), kv("reason", "max-clients"), kv("clients", s.currentClients.Load())}
+	if s.rejectSuppressed > 0 {
+		fields = append(fields, kv("suppressed", s.rejectSuppressed))
+	}
+	logEvent("REJECT", fields...)
+	s.lastRejectLog = now
+	s.rejectSuppressed = 0
+}
+
+// waitForSlot blocks while PauseAtMax is set and the server is full, so
+// that further clients queue in the kernel's accept backlog instead of
+// being accepted and closed. It returns false once the server is closed.
+func (s *Server) waitForSlot() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed {
+		cfg := s.config.Load()
+		if !cfg.PauseAtMax || s.clientCount() < cfg.MaxClients {
+			return true
+		}
+		s.slotFree.Wait()
+	}
+	return false
+}
+
+// clientCount is the number of clients counted against MaxClients.
+func (s *Server) clientCount() int64 {
+	return s.currentClients.Load() + s.admitting.Load()
+}
+
+func (s *Server) signalSlotFree() {
+	s.mu.Lock()
+	s.slotFree.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Shutdown stops every Serve call, then waits for trapped clients to leave
+// on their own until ctx is done, at which point whatever is left is
+// closed, with an RST if Config.ResetOnClose is set. It logs a final STATS
+// line and returns ctx.Err() if clients had to be forced out.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.ready.Store(false)
+	s.slotFree.Broadcast()
+	// Accept() を止めて Serve を抜けさせる
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	s.mu.Unlock()
+	close(s.stopStats)
+
+	logEvent("SHUTDOWN", kv("clients", s.currentClients.Load()))
+
+	done := make(chan struct{})
+	go func() {
+		s.clientsWG.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		// キャンセルで抜けたゴルーチンが閉じる前に RST の設定を済ませておく
+		s.mu.Lock()
+		if s.config.Load().ResetOnClose {
+			for _, byConn := range s.conns {
+				for conn, cs := range byConn {
+					resetOnClose(conn, cs)
+				}
+			}
+		}
+		s.mu.Unlock()
+		s.cancel()
+		// 書き込み中で止まっている接続は閉じないと抜けてこない
+		s.mu.Lock()
+		for _, byConn := range s.conns {
+			for conn := range byConn {
+				conn.Close()
+			}
+		}
+		s.mu.Unlock()
+		<-done
+	}
+
+	// 接続はもう残っていないので、ポーラーのループと fd も片付ける
+	if s.poll != nil {
+		s.poll.close()
+	}
+	s.cancel()
+	s.logStats()
+	s.persistState()
+	return err
+}
+
+// track registers c, the connection of cs, so that Shutdown and Kick can
+// force it closed.
+func (s *Server) track(c io.Closer, cs *clientState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byConn := s.conns[cs.host]
+	if byConn == nil {
+		byConn = make(map[io.Closer]*clientState)
+		s.conns[cs.host] = byConn
+	}
+	byConn[c] = cs
+}
+
+func (s *Server) untrack(c io.Closer, cs *clientState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byConn := s.conns[cs.host]
+	delete(byConn, c)
+	if len(byConn) == 0 {
+		delete(s.conns, cs.host)
+	}
+}
+
+// acquireIP reserves a slot for host, failing if it already holds limit
+// connections. A limit of 0 or less never fails, and neither does an empty
+// host (Unix socket peers have no address to limit on).
+func (s *Server) acquireIP(host string, limit int) bool {
+	s.perIPMu.Lock()
+	defer s.perIPMu.Unlock()
+
+	if limit > 0 && host != "" && s.perIPCounts[host] >= limit {
+		return false
+	}
+	s.perIPCounts[host]++
+	return true
+}
+
+func (s *Server) releaseIP(host string) {
+	s.perIPMu.Lock()
+	defer s.perIPMu.Unlock()
+
+	if s.perIPCounts[host] <= 1 {
+		delete(s.perIPCounts, host)
+		return
+	}
+	s.perIPCounts[host]--
+}
+
+// abandon closes a client that admitClient turned away before beginClient.
+func (s *Server) abandon(conn net.Conn) {
+	conn.Close()
+	s.admitting.Add(-1)
+	s.signalSlotFree()
+	s.clientsWG.Done()
+}
+
+// admitClient runs the checks that need the real client address, which
+// with PROXY protocol is only known after reading the header, and then
+// hands the connection over to handleClient.
+func (s *Server) admitClient(conn net.Conn, conf *atomic.Pointer[Config]) {
+	cfg := conf.Load()
+	// PROXY ヘッダと peek の読み込みは合わせてこの時刻までに終わらせる
+	var handshakeDeadline time.Time
+	if cfg.HandshakeTimeout > 0 {
+		handshakeDeadline = time.Now().Add(cfg.HandshakeTimeout)
+	}
+
+	if cfg.ProxyProtocol {
+		pc, err := readProxyHeader(s.ctx, conn, handshakeDeadline)
+		if err != nil {
+			host, _ := splitAddr(conn.RemoteAddr())
+			switch {
+			case s.ctx.Err() != nil:
+				logEvent("REJECT", kv("host", host), kv("reason", "shutdown"))
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				logEvent("REJECT", kv("host", host), kv("reason", "handshake-timeout"))
+			default:
+				logError("PROXY parse", fmt.Errorf("host=%s: %w", conn.RemoteAddr(), err))
+			}
+			s.abandon(conn)
+			return
+		}
+		conn = pc
+	}
+
+	host, _ := splitAddr(conn.RemoteAddr())
+	if cfg.Deny.contains(host) {
+		logEvent("DROP", kv("host", host))
+		s.abandon(conn)
+		return
+	}
+	if cfg.Allow.contains(host) {
+		logEvent("BYPASS", kv("host", host))
+		s.abandon(conn)
+		return
+	}
+	if s.knocks.contains(host) {
+		logEvent("BYPASS", kv("host", host), kv("reason", "knock"))
+		s.abandon(conn)
+		return
+	}
+
+	if cfg.PerIPRate > 0 && host != "" && !s.perIPRate.allow(host, cfg.PerIPRate) {
+		logEvent("REJECT", kv("host", host), kv("reason", "per-ip-rate"))
+		s.abandon(conn)
+		return
+	}
+	if !s.acquireIP(host, cfg.PerIPLimit) {
+		logEvent("REJECT", kv("host", host), kv("reason", "per-ip-limit"))
+		s.abandon(conn)
+		return
+	}
+
+	if cfg.TLS != nil {
+		tc, err := tlsHandshake(s.ctx, conn, cfg.TLS, handshakeDeadline)
+		if err != nil {
+			reason := "tls-handshake"
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				reason = "handshake-timeout"
+			}
+			logEvent("REJECT", kv("host", host), kv("reason", reason), kv("error", err))
+			s.releaseIP(host)
+			s.abandon(conn)
+			return
+		}
+		conn = tc
+	}
+
+	if cfg.WaitForClient {
+		banner, err := readClientLine(s.ctx, conn, handshakeDeadline)
+		if err != nil {
+			reason := "no-client-banner"
+			switch {
+			case s.ctx.Err() != nil:
+				reason = "shutdown"
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				reason = "handshake-timeout"
+			}
+			logEvent("REJECT", kv("host", host), kv("reason", reason))
+			s.releaseIP(host)
+			s.abandon(conn)
+			return
+		}
+		logEvent("CLIENTBANNER", kv("host", host), kv("banner", quoted(sanitizeClientLine(banner))))
+	} else if cfg.Peek > 0 {
+		// 黙っているクライアントこそ捕まえたいので、期限が来ても切断はしない
+		peekDeadline := time.Now().Add(cfg.Peek)
+		if !handshakeDeadline.IsZero() && handshakeDeadline.Before(peekDeadline) {
+			peekDeadline = handshakeDeadline
+		}
+		n, line := peekClient(conn, peekDeadline)
+		logEvent("CLIENTDATA", kv("host", host), kv("bytes", n))
+		if n > 0 {
+			logEvent("CLIENTBANNER", kv("host", host), kv("banner", quoted(sanitizeClientLine(line))))
+		}
+	}
+
+	// ポーラーは素のソケットに直接書くので、TLS の接続は goroutine で扱う
+	if s.poll != nil && cfg.TLS == nil {
+		s.poll.add(conn, conf)
+		return
+	}
+	s.handleClient(s.ctx, conn, conf)
+}
@@ -0,0 +1,74 @@
+package orexis
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// savedState is the JSON written to Config.StateFile so that lifetime
+// totals survive restarts. Current and peak clients always start at zero.
+type savedState struct {
+	TotalConnects int64     `json:"total_connects"`
+	BytesSent     int64     `json:"bytes_sent"`
+	SavedAt       time.Time `json:"saved_at"`
+}
+
+// loadState resumes the totals from path. A missing file is a first run,
+// and an unreadable one is reported and ignored rather than keeping the
+// tarpit from starting.
+func (s *Server) loadState(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var st savedState
+	if err == nil {
+		err = json.Unmarshal(data, &st)
+	}
+	if err != nil {
+		logInfo("Warning: state file %s ignored, starting totals from zero: %v", path, err)
+		return
+	}
+
+	s.totalConnects.Store(st.TotalConnects)
+	s.bytesSent.Store(st.BytesSent)
+	// 最初の BytesPerSec が過去の累計で跳ねないようにする
+	s.lastStatsBytes = st.BytesSent
+}
+
+// saveState writes the totals to path through a temporary file and a
+// rename, so a crash mid-write leaves the previous state intact.
+func (s *Server) saveState(path string) error {
+	data, err := json.Marshal(savedState{
+		TotalConnects: s.totalConnects.Load(),
+		BytesSent:     s.bytesSent.Load(),
+		SavedAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
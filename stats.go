@@ -0,0 +1,147 @@
+package orexis
+
+import (
+	"runtime"
+	"time"
+)
+
+// Stats is a point-in-time view of a server's counters. The connection
+// counters are read together, so TotalConnects is always at least
+// CurrentClients + ImmediateDrops + HookedClients plus whatever a state file
+// carried over; the rest got no bytes for another reason, such as Shutdown.
+// The byte counters are updated on every write without that coordination
+// and may be slightly ahead of them.
+type Stats struct {
+	CurrentClients int64
+	PeakClients    int64
+	TotalConnects  int64
+	// MaxClients に達していて断った接続の数
+	RejectedConnects int64
+	// 1行も送る前に相手から切った接続 (reason=immediate-drop) と、1行以上送れた接続の数
+	ImmediateDrops int64
+	HookedClients  int64
+	// 直近の STATS 以降と起動してからの、異なる送信元 IP の数 (HyperLogLog による概算)
+	DistinctIPs      int64
+	TotalDistinctIPs int64
+	BytesSent        int64
+	// 直近の STATS 区間の送信レート
+	BytesPerSec int64
+	// 直近の STATS 時点のゴルーチン数とヒープ使用量。ReadMemStats は重いので STATS のときだけ測る
+	Goroutines int64
+	HeapAlloc  int64
+}
+
+// Stats returns the server's current counters.
+func (s *Server) Stats() Stats {
+	st := s.counters(false)
+	st.DistinctIPs, st.TotalDistinctIPs = s.distinct.counts(false)
+	st.BytesPerSec = s.lastBytesPerSec.Load()
+	st.Goroutines = s.lastGoroutines.Load()
+	st.HeapAlloc = s.lastHeapAlloc.Load()
+	return st
+}
+
+// counters reads the raw counters as one snapshot, which is what Stats,
+// STATS and the metrics share. With resetPeak the next peak starts from the
+// clients connected now, as RollingPeak wants.
+func (s *Server) counters(resetPeak bool) Stats {
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+
+	st := Stats{
+		CurrentClients:   s.currentClients.Load(),
+		TotalConnects:    s.totalConnects.Load(),
+		RejectedConnects: s.rejectedConnects.Load(),
+		ImmediateDrops:   s.immediateDrops.Load(),
+		HookedClients:    s.hookedClients.Load(),
+		BytesSent:        s.bytesSent.Load(),
+	}
+	if resetPeak {
+		st.PeakClients = s.peakClients.Swap(st.CurrentClients)
+	} else {
+		st.PeakClients = s.peakClients.Load()
+	}
+	return st
+}
+
+func (s *Server) statsReporter(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.LogStats()
+			s.persistState()
+		case <-s.stopStats:
+			return
+		}
+	}
+}
+
+// LogStats logs a STATS line, and TOPIPS if enabled, right away. It is the
+// same report the stats interval produces, so it also starts a new
+// interval for BytesPerSec, DistinctIPs and RollingPeak.
+func (s *Server) LogStats() {
+	s.logStats()
+	s.logTopIPs()
+}
+
+func (s *Server) logStats() {
+	// RollingPeak なら次の区間は今いる接続数から数え直す
+	st := s.counters(s.config.Load().RollingPeak)
+	bytes := st.BytesSent
+	distinct, totalDistinct := s.distinct.counts(true)
+
+	s.statsMu.Lock()
+	now := time.Now()
+	var bps int64
+	if elapsed := now.Sub(s.lastStatsTime).Seconds(); elapsed > 0 {
+		bps = int64(float64(bytes-s.lastStatsBytes) / elapsed)
+	}
+	s.lastStatsTime, s.lastStatsBytes = now, bytes
+	s.statsMu.Unlock()
+	s.lastBytesPerSec.Store(bps)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	goroutines := int64(runtime.NumGoroutine())
+	s.lastGoroutines.Store(goroutines)
+	s.lastHeapAlloc.Store(int64(mem.HeapAlloc))
+
+	logEvent("STATS:",
+		kv("CurrentClients", st.CurrentClients),
+		kv("PeakClients", st.PeakClients),
+		kv("TotalConnects", st.TotalConnects),
+		kv("RejectedConnects", st.RejectedConnects),
+		kv("ImmediateDrops", st.ImmediateDrops),
+		kv("HookedClients", st.HookedClients),
+		kv("DistinctIPs", distinct),
+		kv("TotalDistinctIPs", totalDistinct),
+		kv("TotalBytesSent", bytes),
+		kv("BytesPerSec", bps),
+		kv("Goroutines", goroutines),
+		kv("HeapAlloc", mem.HeapAlloc),
+	)
+}
+
+// persistState saves the totals if Config.StateFile is set.
+func (s *Server) persistState() {
+	path := s.config.Load().StateFile
+	if path == "" {
+		return
+	}
+	if err := s.saveState(path); err != nil {
+		logError("State file", err)
+	}
+}
+
+// updatePeak raises peakClients to n if n is higher.
+func (s *Server) updatePeak(n int64) {
+	for {
+		peak := s.peakClients.Load()
+		if n <= peak || s.peakClients.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
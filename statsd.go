@@ -0,0 +1,70 @@
+package orexis
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statsdPrefix    = "orexis."
+	statsdQueueSize = 1024
+	// 送信バイト数は書き込みごとではなく、この間隔でまとめて送る
+	statsdFlushInterval = time.Second
+)
+
+// statsdClient sends counters and gauges to a statsd server over UDP. It
+// never blocks the caller: metrics are queued and dropped if the sender is
+// behind, and send errors (e.g. nothing listening) are ignored.
+type statsdClient struct {
+	conn  net.Conn
+	queue chan string
+	bytes *atomic.Int64
+}
+
+// startStatsd starts sending to addr. bytes is the running total of bytes
+// sent, reported as a counter of its increase every statsdFlushInterval.
+func startStatsd(addr string, bytes *atomic.Int64) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &statsdClient{conn: conn, queue: make(chan string, statsdQueueSize), bytes: bytes}
+	go c.run()
+	return c, nil
+}
+
+func (c *statsdClient) count(name string, n int64) {
+	c.enqueue(fmt.Sprintf("%s%s:%d|c", statsdPrefix, name, n))
+}
+
+func (c *statsdClient) gauge(name string, v int64) {
+	c.enqueue(fmt.Sprintf("%s%s:%d|g", statsdPrefix, name, v))
+}
+
+func (c *statsdClient) enqueue(metric string) {
+	select {
+	case c.queue <- metric:
+	default:
+	}
+}
+
+func (c *statsdClient) run() {
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	last := c.bytes.Load()
+	for {
+		select {
+		case metric := <-c.queue:
+			c.conn.Write([]byte(metric))
+		case <-ticker.C:
+			// 再起動で状態ファイルから読み込んだ分は最初の last に入るので送らない
+			if now := c.bytes.Load(); now > last {
+				c.conn.Write(fmt.Appendf(nil, "%sbytes_sent:%d|c", statsdPrefix, now-last))
+				last = now
+			}
+		}
+	}
+}
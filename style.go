@@ -0,0 +1,68 @@
+package orexis
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+const (
+	StyleRandom = "random"
+	// 子音と母音を交互に並べた単語を空白で区切る。スキャン結果を人が眺めても不自然に見えにくい
+	StyleWordlike = "wordlike"
+)
+
+func validateStyle(style string) error {
+	switch style {
+	case StyleRandom, StyleWordlike:
+		return nil
+	}
+	return fmt.Errorf("unknown style %q (want %s or %s)", style, StyleRandom, StyleWordlike)
+}
+
+// fillWordlike fills buf with words of two to eight lowercase letters,
+// alternating consonants and vowels, separated by single spaces. The body
+// never starts or ends with a space. Letters or the space removed with
+// ExcludeBytes are not used; if either kind of letter is gone entirely,
+// the other is used alone.
+func (a *alphabet) fillWordlike(rng *rand.Rand, buf []byte) {
+	vowels, consonants := a.vowels, a.consonants
+	if len(vowels) == 0 {
+		vowels = consonants
+	}
+	if len(consonants) == 0 {
+		consonants = vowels
+	}
+	if len(vowels) == 0 {
+		// 英小文字がすべて除外されていれば通常のランダムな行にする
+		a.fill(rng, buf)
+		return
+	}
+	space := a.allows(' ')
+
+	for i := 0; i < len(buf); {
+		// 空白の後には最低1文字必要なので、残りが2バイト以上のときだけ区切る
+		if i > 0 && space && len(buf)-i >= 2 {
+			buf[i] = ' '
+			i++
+		}
+		vowel := rng.IntN(2) == 0
+		for n := min(2+rng.IntN(7), len(buf)-i); n > 0; n-- {
+			set := consonants
+			if vowel {
+				set = vowels
+			}
+			buf[i] = set[rng.IntN(len(set))]
+			vowel = !vowel
+			i++
+		}
+	}
+}
+
+func (a *alphabet) allows(b byte) bool {
+	for _, c := range a.bytes {
+		if c == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package orexis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFillWordlikeLettersAndSpaces(t *testing.T) {
+	a := alphabetFor(CharsetASCII, StyleWordlike, "")
+	rng := NewSeededRand(1)
+	for i := 0; i < 1000; i++ {
+		buf := make([]byte, 1+rng.IntN(MaxLineLengthLimit))
+		a.fillWordlike(rng, buf)
+		for _, b := range buf {
+			if b != ' ' && (b < 'a' || b > 'z') {
+				t.Fatalf("body %q has %q", buf, b)
+			}
+		}
+		if buf[0] == ' ' || buf[len(buf)-1] == ' ' || strings.Contains(string(buf), "  ") {
+			t.Fatalf("body %q has a leading, trailing or double space", buf)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package orexis
+
+import "fmt"
+
+const (
+	TerminatorCRLF = "crlf"
+	TerminatorLF   = "lf"
+	// 区切りなし。行単位で読む相手は1行目を永遠に読み終わらない
+	TerminatorNone = "none"
+)
+
+func validateTerminator(terminator string) error {
+	switch terminator {
+	case TerminatorCRLF, TerminatorLF, TerminatorNone:
+		return nil
+	}
+	return fmt.Errorf("unknown terminator %q (want %s, %s or %s)", terminator, TerminatorCRLF, TerminatorLF, TerminatorNone)
+}
+
+// terminatorBytes returns what ends each line for a validated terminator.
+func terminatorBytes(terminator string) string {
+	switch terminator {
+	case TerminatorLF:
+		return "\n"
+	case TerminatorNone:
+		return ""
+	}
+	return "\r\n"
+}
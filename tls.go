@@ -0,0 +1,25 @@
+package orexis
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// tlsHandshake wraps conn in TLS and completes the handshake by deadline,
+// so that line writes go through the encrypted stream. A zero deadline
+// waits until ctx is canceled.
+func tlsHandshake(ctx context.Context, conn net.Conn, config *tls.Config, deadline time.Time) (net.Conn, error) {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	tc := tls.Server(conn, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
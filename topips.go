@@ -0,0 +1,98 @@
+package orexis
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// 送信元を変えてくる相手でメモリが増え続けないよう、数える IP の数に上限を設ける
+const maxTrackedIPs = 10000
+
+// ipCounter counts connections per source IP since start, keeping at most
+// maxTrackedIPs entries by forgetting the least-seen ones.
+type ipCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newIPCounter() *ipCounter {
+	return &ipCounter{counts: make(map[string]int64)}
+}
+
+func (c *ipCounter) add(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.counts[host]; !ok && len(c.counts) >= maxTrackedIPs {
+		c.evict()
+	}
+	c.counts[host]++
+}
+
+// evict drops the least-seen quarter of the entries at once, so that a
+// flood of new addresses does not sort the map on every connection.
+func (c *ipCounter) evict() {
+	counts := make([]int64, 0, len(c.counts))
+	for _, n := range c.counts {
+		counts = append(counts, n)
+	}
+	slices.Sort(counts)
+	quarter := len(counts) / 4
+	threshold := counts[quarter]
+
+	// threshold と同じ回数の IP は全部消すと多すぎることがあるので、4分の1に達するまでにする
+	removed := 0
+	for host, n := range c.counts {
+		if n < threshold {
+			delete(c.counts, host)
+			removed++
+		}
+	}
+	for host, n := range c.counts {
+		if removed >= quarter {
+			break
+		}
+		if n == threshold {
+			delete(c.counts, host)
+			removed++
+		}
+	}
+}
+
+type ipCount struct {
+	host  string
+	count int64
+}
+
+// top returns the n most frequent hosts, most frequent first.
+func (c *ipCounter) top(n int) []ipCount {
+	c.mu.Lock()
+	all := make([]ipCount, 0, len(c.counts))
+	for host, count := range c.counts {
+		all = append(all, ipCount{host, count})
+	}
+	c.mu.Unlock()
+
+	slices.SortFunc(all, func(a, b ipCount) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), strings.Compare(a.host, b.host))
+	})
+	return all[:min(n, len(all))]
+}
+
+// logTopIPs logs the TopIPs busiest sources as host=count pairs.
+func (s *Server) logTopIPs() {
+	if s.ipCounts == nil {
+		return
+	}
+	top := s.ipCounts.top(s.config.Load().TopIPs)
+	if len(top) == 0 {
+		return
+	}
+	fields := make([]field, len(top))
+	for i, t := range top {
+		fields[i] = kv(t.host, t.count)
+	}
+	logEvent("TOPIPS:", fields...)
+}